@@ -0,0 +1,198 @@
+//
+// Threshold alerts (-alert), for using netvolmon as a simple watchdog.
+// An alert is a comma-separated list of conditions like 'rx>100MB/s',
+// 'total>800Mbit/s' or 'rxpps>50000', on rx, tx or total bytes a
+// second (written in the same units we report in) or rxpps, txpps or
+// totalpps packets a second, with > or <. When a device meets a
+// condition for -alert-for intervals in a row we say so on standard
+// error and run the -on-alert command, if there is one, with 'sh -c'
+// and these in the environment:
+//
+//	NETVOLMON_DEVICE      the device
+//	NETVOLMON_ALERT       the condition, eg 'rx>100MB/s'
+//	NETVOLMON_RATE        the device's rate, in bytes or packets/sec
+//	NETVOLMON_THRESHOLD   the condition's rate, the same way
+//
+// We don't alert again until the device stops meeting the condition.
+//
+// For a lighter touch, -bell rings the terminal bell on each alert and
+// -highlight shows devices that are alerting in bold red.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var alertSpec string
+var alertFor int
+var onAlert string
+var alertBell, alertHighlight bool
+
+// The ANSI escapes for -highlight.
+const highlightOn = "\x1b[1;31m"
+const highlightOff = "\x1b[0m"
+
+type alertCond struct {
+	text      string
+	field     string
+	less      bool
+	threshold float64
+}
+
+var alerts []alertCond
+
+// alertFields get a field's rate from an interval, per second.
+var alertFields = map[string]func(dt DevDelta) uint64{
+	"rx":       func(dt DevDelta) uint64 { return dt.RBytes },
+	"tx":       func(dt DevDelta) uint64 { return dt.TBytes },
+	"total":    func(dt DevDelta) uint64 { return dt.RBytes + dt.TBytes },
+	"rxpps":    func(dt DevDelta) uint64 { return dt.RPackets },
+	"txpps":    func(dt DevDelta) uint64 { return dt.TPackets },
+	"totalpps": func(dt DevDelta) uint64 { return dt.RPackets + dt.TPackets },
+}
+
+// alertStreaks counts how many intervals in a row a device has met
+// each condition, by device and condition.
+var alertStreaks = make(map[string][]int)
+
+// parseRate parses a rate in bytes/sec ('100MB/s', '800Mbit/s').
+func parseRate(s string) (float64, error) {
+	r := strings.TrimSuffix(s, "/s")
+	lr := strings.ToLower(r)
+	if strings.HasSuffix(lr, "bit") {
+		mult := 1.0 / 8
+		num := lr[:len(lr)-3]
+		switch {
+		case strings.HasSuffix(num, "k"):
+			mult = kBit
+		case strings.HasSuffix(num, "m"):
+			mult = mBit
+		case strings.HasSuffix(num, "g"):
+			mult = gBit
+		}
+		if mult != 1.0/8 {
+			num = num[:len(num)-1]
+		}
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad rate '%s'", s)
+		}
+		return n * mult, nil
+	}
+	n, err := parseSize(r)
+	if err != nil {
+		return 0, fmt.Errorf("bad rate '%s'", s)
+	}
+	return float64(n), nil
+}
+
+// parseAlerts parses -alert.
+func parseAlerts(spec string) ([]alertCond, error) {
+	var conds []alertCond
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.TrimSpace(c)
+		op := strings.IndexAny(c, "<>")
+		if op <= 0 {
+			return nil, fmt.Errorf("'%s' isn't <field>><rate> or <field><<rate>", c)
+		}
+		ac := alertCond{text: c, field: strings.ToLower(c[:op]), less: c[op] == '<'}
+		if alertFields[ac.field] == nil {
+			return nil, fmt.Errorf("'%s': unknown field '%s'", c, ac.field)
+		}
+		var err error
+		if strings.HasSuffix(ac.field, "pps") {
+			ac.threshold, err = strconv.ParseFloat(c[op+1:], 64)
+		} else {
+			ac.threshold, err = parseRate(c[op+1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %s", c, err)
+		}
+		conds = append(conds, ac)
+	}
+	return conds, nil
+}
+
+// checkAlerts checks a device's interval against our conditions,
+// alerting as necessary. It returns whether the device is currently
+// alerting on anything.
+func checkAlerts(c *config, devname string, dt DevDelta) bool {
+	persec := float64(dt.Delta) / float64(time.Second)
+	streaks := alertStreaks[devname]
+	if streaks == nil {
+		streaks = make([]int, len(alerts))
+		alertStreaks[devname] = streaks
+	}
+	alerting := false
+	for i, ac := range alerts {
+		rate := float64(alertFields[ac.field](dt)) / persec
+		met := rate > ac.threshold
+		if ac.less {
+			met = rate < ac.threshold
+		}
+		if !met {
+			streaks[i] = 0
+			continue
+		}
+		streaks[i]++
+		if streaks[i] >= alertFor {
+			alerting = true
+		}
+		if streaks[i] == alertFor {
+			fireAlert(c, devname, ac, rate)
+		}
+	}
+	return alerting
+}
+
+// fireAlert reports an alert and starts the -on-alert command. We
+// don't wait for it.
+func fireAlert(c *config, devname string, ac alertCond, rate float64) {
+	shown := c.fmtRate(rate)
+	if strings.HasSuffix(ac.field, "pps") {
+		shown = fmt.Sprintf("%.0f pps", rate)
+	}
+	if !quiet {
+		log.Printf("alert: %s %s (%s)", devname, ac.text, strings.TrimSpace(shown))
+	}
+	if sysLogTo != nil {
+		sysLogAlert(devname, ac, rate)
+	}
+	// The bell goes to standard error so that it can't end up in a
+	// file or in JSON.
+	if alertBell {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+	if desktopNotify {
+		notify(devname, "alert "+ac.text, fmt.Sprintf("netvolmon: alert on %s", devname),
+			fmt.Sprintf("%s (%s)", ac.text, strings.TrimSpace(shown)))
+	}
+	if onAlert == "" {
+		return
+	}
+	cmd := exec.Command("sh", "-c", onAlert)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"NETVOLMON_DEVICE="+devname,
+		"NETVOLMON_ALERT="+ac.text,
+		"NETVOLMON_RATE="+fmtFloat(rate),
+		"NETVOLMON_THRESHOLD="+fmtFloat(ac.threshold))
+	if err := cmd.Start(); err != nil {
+		log.Printf("-on-alert: %s", err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("-on-alert: %s", err)
+		}
+	}()
+}
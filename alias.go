@@ -0,0 +1,64 @@
+//
+// Device aliases (-alias dev=name,dev=name,...), so that reports can
+// say 'uplink' and 'storage' instead of eth0 and enp3s0f1. The device
+// can be given by one of its Linux altnames, and a device that you
+// asked to watch by an altname is called that unless it has an alias.
+// Like -group, -alias can be repeated, including in the config file:
+//
+//	alias eth0=uplink
+//	alias eth1=storage
+//
+// Aliases are only names in reports; on the command line and in -x,
+// devices still go by their real names (or altnames).
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aliasFlags is the -alias arguments, which may be repeated.
+type aliasFlags []string
+
+func (a *aliasFlags) String() string {
+	return strings.Join(*a, ",")
+}
+
+func (a *aliasFlags) Set(v string) error {
+	for _, al := range strings.Split(v, ",") {
+		eq := strings.IndexByte(al, '=')
+		if eq <= 0 || eq == len(al)-1 {
+			return fmt.Errorf("'%s' isn't device=alias", al)
+		}
+		*a = append(*a, al)
+	}
+	return nil
+}
+
+var aliasArgs aliasFlags
+
+// devAliases maps real device names to their alias, if they have
+// one. They win over devLabels.
+var devAliases = make(map[string]string)
+
+// setupAliases settles what we call devices, given the command line
+// devices. Altnames can change, so this is redone on reloads.
+func setupAliases(ni *netInfo, devices []string) {
+	aliases := make(map[string]string)
+	for _, d := range devices {
+		if dev, ok := ni.altnames[d]; ok {
+			aliases[dev] = d
+		}
+	}
+	for _, al := range aliasArgs {
+		eq := strings.IndexByte(al, '=')
+		dev := al[:eq]
+		if real, ok := ni.altnames[dev]; ok {
+			dev = real
+		}
+		aliases[dev] = al[eq+1:]
+	}
+	devAliases = aliases
+}
@@ -0,0 +1,62 @@
+//
+// When we report. We go by a ticker rather than sleeping for -d after
+// each report, so the time we take to gather stats and report on them
+// doesn't push every later report back; over a long run with a short
+// -d, that adds up. If we fall behind, we skip ticks rather than
+// bunching reports together.
+//
+// Normally we report every -d from whenever we started; with -align we report when the local time is a
+// multiple of -d, so '-d 60s' reports on the minute and '-d 1h' on the
+// hour, lining up with cron jobs and other people's graphs. The first
+// report covers whatever is left of the current interval, unless that's
+// too little to be worth reporting, in which case we wait out the next
+// one as well.
+//
+
+package main
+
+import (
+	"time"
+)
+
+var alignReports bool
+
+// reportTicks returns a channel that gets a value every time it's
+// time to report. Like a time.Ticker's, it holds at most one tick
+// that hasn't been taken yet and drops any others, so a slow report
+// isn't followed by two at once.
+func reportTicks() <-chan time.Time {
+	c := make(chan time.Time, 1)
+	send := func(now time.Time) {
+		select {
+		case c <- now:
+		default:
+		}
+	}
+	go func() {
+		time.Sleep(untilNext(time.Now()))
+		t := time.NewTicker(duration)
+		send(time.Now())
+		for now := range t.C {
+			send(now)
+		}
+	}()
+	return c
+}
+
+// untilNext is how long to wait from now for the first report.
+func untilNext(now time.Time) time.Duration {
+	if !alignReports {
+		return duration
+	}
+	// Truncate works in absolute time, which is UTC, so we shift
+	// into local time and back.
+	_, off := now.Zone()
+	shift := time.Duration(off) * time.Second
+	next := now.Add(shift).Truncate(duration).Add(duration).Add(-shift)
+	wait := next.Sub(now)
+	if wait < duration/4 {
+		wait += duration
+	}
+	return wait
+}
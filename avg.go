@@ -0,0 +1,59 @@
+//
+// Moving averages (-avg N). Alongside each interval's rates we print
+// the device's average RX and TX rates over its last N intervals, so
+// that a short burst doesn't dominate your impression of how busy a
+// device is.
+//
+
+package main
+
+import (
+	"time"
+)
+
+var avgWindow int
+
+// An avgHistory is a ring buffer of a device's recent intervals. We
+// keep bytes and durations rather than rates so that the average is
+// weighted by time, which matters if intervals aren't all the same
+// length.
+type avgHistory struct {
+	rx, tx []uint64
+	dur    []time.Duration
+	next   int
+	n      int
+}
+
+var avgHist = make(map[string]*avgHistory)
+
+// movingAvg adds this interval to the device's history and returns
+// its average RX and TX rates in bytes per second. Until we have N
+// intervals, we average over what we have.
+func movingAvg(devname string, dt DevDelta) (float64, float64) {
+	h, ok := avgHist[devname]
+	if !ok {
+		h = &avgHistory{
+			rx:  make([]uint64, avgWindow),
+			tx:  make([]uint64, avgWindow),
+			dur: make([]time.Duration, avgWindow),
+		}
+		avgHist[devname] = h
+	}
+	h.rx[h.next] = dt.RBytes
+	h.tx[h.next] = dt.TBytes
+	h.dur[h.next] = dt.Delta
+	h.next = (h.next + 1) % avgWindow
+	if h.n < avgWindow {
+		h.n++
+	}
+
+	var rx, tx uint64
+	var dur time.Duration
+	for i := 0; i < h.n; i++ {
+		rx += h.rx[i]
+		tx += h.tx[i]
+		dur += h.dur[i]
+	}
+	secs := float64(dur) / float64(time.Second)
+	return float64(rx) / secs, float64(tx) / secs
+}
@@ -0,0 +1,127 @@
+//
+// Batched inserts into databases, for -clickhouse and -sql. Rows are
+// collected as we report and handed off once a full batch is ready,
+// at most once per interval, to a goroutine that does the actual
+// inserting. A database that's slow or down therefore never holds up
+// our reports. If an insert fails we keep trying it, backing off up
+// to batchRetryMax, while new batches wait in a queue; once too many
+// are waiting we throw away the oldest.
+//
+
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	batchRetryMin = time.Second
+	batchRetryMax = 5 * time.Minute
+	// How many batches can be waiting to be inserted.
+	batchQueued = 10
+	// How long we give our last rows to go in when we stop.
+	batchCloseWait = 10 * time.Second
+)
+
+// A batcher collects rows of type R and inserts them in batches with
+// its insert function, from its own goroutine.
+type batcher[R any] struct {
+	name    string
+	batch   int
+	rows    []R
+	queue   chan []R
+	insert  func([]R) error
+	closing chan struct{}
+	done    chan struct{}
+}
+
+func newBatcher[R any](name string, batch int, insert func([]R) error) *batcher[R] {
+	b := &batcher[R]{
+		name:    name,
+		batch:   batch,
+		queue:   make(chan []R, batchQueued),
+		insert:  insert,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add adds a row to the pending batch.
+func (b *batcher[R]) add(r R) {
+	b.rows = append(b.rows, r)
+}
+
+// flush hands the pending rows off to be inserted if there's a full
+// batch of them. It's called once per interval.
+func (b *batcher[R]) flush() {
+	if len(b.rows) >= b.batch {
+		b.send()
+	}
+}
+
+// send queues the pending rows, making room by dropping the oldest
+// waiting batch if we have to.
+func (b *batcher[R]) send() {
+	rows := b.rows
+	b.rows = nil
+	for {
+		select {
+		case b.queue <- rows:
+			return
+		default:
+		}
+		select {
+		case old := <-b.queue:
+			log.Printf("%s: too many failed inserts, throwing away %d rows", b.name, len(old))
+		default:
+		}
+	}
+}
+
+func (b *batcher[R]) run() {
+	defer close(b.done)
+	delay := batchRetryMin
+	for rows := range b.queue {
+		for {
+			err := b.insert(rows)
+			if err == nil {
+				delay = batchRetryMin
+				break
+			}
+			// When we're stopping, we only try once.
+			select {
+			case <-b.closing:
+				log.Printf("%s insert of %d rows failed: %s", b.name, len(rows), err)
+				return
+			default:
+			}
+			log.Printf("%s insert of %d rows failed: %s; trying again in %s", b.name, len(rows), err, delay)
+			select {
+			case <-time.After(delay):
+			case <-b.closing:
+			}
+			delay *= 2
+			if delay > batchRetryMax {
+				delay = batchRetryMax
+			}
+		}
+	}
+}
+
+// close makes one last try at inserting whatever rows we still have
+// (and anything still queued), waiting a while for them to go in.
+func (b *batcher[R]) close() {
+	if len(b.rows) > 0 {
+		b.send()
+	}
+	close(b.queue)
+	close(b.closing)
+	select {
+	case <-b.done:
+	case <-time.After(batchCloseWait):
+		log.Printf("%s: giving up on inserting our last rows", b.name)
+	}
+}
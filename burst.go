@@ -0,0 +1,64 @@
+//
+// Microburst detection (-B). We keep a short trailing history of
+// each device's RX and TX rates and flag intervals where either rate
+// jumps well above its trailing average.
+//
+
+package main
+
+import (
+	"time"
+)
+
+var burstFactor float64
+var burstWindow int
+
+// A rateHistory is a ring buffer of a device's recent rates, in bytes
+// per second.
+type rateHistory struct {
+	rx, tx []float64
+	next   int
+	filled bool
+}
+
+var burstHist = make(map[string]*rateHistory)
+
+func average(rates []float64) float64 {
+	sum := 0.0
+	for _, r := range rates {
+		sum += r
+	}
+	return sum / float64(len(rates))
+}
+
+// isBurst reports whether this interval for the device is a burst
+// compared to its trailing history, then adds it to that history.
+// We don't flag anything until we have a full window of history,
+// because otherwise startup looks like one big burst.
+func isBurst(devname string, dt DevDelta) bool {
+	persec := float64(dt.Delta) / float64(time.Second)
+	rx := float64(dt.RBytes) / persec
+	tx := float64(dt.TBytes) / persec
+
+	h, ok := burstHist[devname]
+	if !ok {
+		h = &rateHistory{rx: make([]float64, burstWindow), tx: make([]float64, burstWindow)}
+		burstHist[devname] = h
+	}
+
+	burst := false
+	if h.filled {
+		arx, atx := average(h.rx), average(h.tx)
+		burst = (arx > 0 && rx > arx*burstFactor) ||
+			(atx > 0 && tx > atx*burstFactor)
+	}
+
+	h.rx[h.next] = rx
+	h.tx[h.next] = tx
+	h.next++
+	if h.next == burstWindow {
+		h.next = 0
+		h.filled = true
+	}
+	return burst
+}
@@ -0,0 +1,145 @@
+//
+// End of run charts (-chart). We keep the whole run's history of RX
+// and TX rates for every device we report on and, when we're stopped,
+// write a simple SVG line chart for each of them into a directory.
+//
+// This is deliberately minimal; it's meant to produce something you
+// can attach to a ticket, not to replace a real graphing system.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var chartDir string
+
+// A sample is a device's RX and TX rate at a point in time, in bytes
+// per second.
+type sample struct {
+	when   time.Time
+	rx, tx float64
+}
+
+var histMu sync.Mutex
+var history = make(map[string][]sample)
+
+// noteHistory adds a device's interval to its history.
+func noteHistory(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	s := sample{dt.When, float64(dt.RBytes) / persec, float64(dt.TBytes) / persec}
+	histMu.Lock()
+	history[devname] = append(history[devname], s)
+	histMu.Unlock()
+}
+
+// Chart geometry, in SVG user units.
+const (
+	chartW      = 800
+	chartH      = 300
+	chartLeft   = 80
+	chartRight  = 20
+	chartTop    = 30
+	chartBottom = 30
+	chartGrid   = 4
+)
+
+// writeChart writes an SVG chart of one device's history.
+func writeChart(c *config, w io.Writer, devname string, hist []sample) {
+	maxrate := 0.0
+	for _, s := range hist {
+		if s.rx > maxrate {
+			maxrate = s.rx
+		}
+		if s.tx > maxrate {
+			maxrate = s.tx
+		}
+	}
+	bwD, bwU := c.getBwDiv(maxrate)
+	// Leave a bit of headroom, and avoid dividing by zero for
+	// entirely idle devices.
+	top := maxrate * 1.1
+	if top == 0 {
+		top = bwD
+	}
+
+	start := hist[0].when
+	span := hist[len(hist)-1].when.Sub(start)
+	if span <= 0 {
+		span = time.Second
+	}
+	plotW := float64(chartW - chartLeft - chartRight)
+	plotH := float64(chartH - chartTop - chartBottom)
+	xpos := func(t time.Time) float64 {
+		return chartLeft + plotW*float64(t.Sub(start))/float64(span)
+	}
+	ypos := func(r float64) float64 {
+		return chartTop + plotH*(1-r/top)
+	}
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", chartW, chartH)
+	fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	title := devname
+	if d := c.netinfo.descs[devname]; d != "" {
+		title += " (" + d + ")"
+	}
+	fmt.Fprintf(w, `<text x="%d" y="18">%s: RX (blue) and TX (red), %s</text>`+"\n", chartLeft, xmlEscape(title), bwU)
+
+	for i := 0; i <= chartGrid; i++ {
+		r := top * float64(i) / chartGrid
+		y := ypos(r)
+		fmt.Fprintf(w, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n", chartLeft, y, chartW-chartRight, y)
+		fmt.Fprintf(w, `<text x="%d" y="%.1f" text-anchor="end">%.2f</text>`+"\n", chartLeft-6, y+4, r/bwD)
+	}
+	fmt.Fprintf(w, `<text x="%d" y="%d">%s</text>`+"\n", chartLeft, chartH-10, start.Format(HMS))
+	fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", chartW-chartRight, chartH-10, hist[len(hist)-1].when.Format(HMS))
+
+	for _, line := range []struct {
+		color string
+		rate  func(s sample) float64
+	}{
+		{"blue", func(s sample) float64 { return s.rx }},
+		{"red", func(s sample) float64 { return s.tx }},
+	} {
+		pts := make([]string, len(hist))
+		for i, s := range hist {
+			pts[i] = fmt.Sprintf("%.1f,%.1f", xpos(s.when), ypos(line.rate(s)))
+		}
+		fmt.Fprintf(w, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`+"\n", line.color, strings.Join(pts, " "))
+	}
+	fmt.Fprintf(w, "</svg>\n")
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+// writeCharts writes charts for every device with any history into
+// the chart directory, as <device>.svg. Problems are reported but
+// we carry on with other devices.
+func writeCharts(c *config, dir string) {
+	histMu.Lock()
+	defer histMu.Unlock()
+
+	devs := sortedKeys(history)
+	for _, dev := range devs {
+		fname := filepath.Join(dir, dev+".svg")
+		f, err := os.Create(fname)
+		if err != nil {
+			log.Printf("writing chart: %s", err)
+			continue
+		}
+		writeChart(c, f, dev, history[dev])
+		if err := f.Close(); err != nil {
+			log.Printf("writing chart: %s", err)
+		}
+	}
+}
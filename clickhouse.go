@@ -0,0 +1,123 @@
+//
+// A ClickHouse sink (-clickhouse), for people who keep their metrics
+// in a warehouse. We batch up per-device samples and insert them with
+// ClickHouse's HTTP interface in JSONEachRow format, which means we
+// don't need a database driver (for other databases, see -sql in
+// sqlsink.go). The table should look something like:
+//
+//	CREATE TABLE netvolmon (
+//		time     DateTime64(3, 'UTC'),
+//		host     String,
+//		device   String,
+//		interval Float64,
+//		rx_bps   Float64,
+//		tx_bps   Float64,
+//		rx_pps   Float64,
+//		tx_pps   Float64
+//	) ENGINE = MergeTree ORDER BY (host, device, time)
+//
+// Rates are bytes and packets per second; interval is in seconds.
+// Inserts happen in the background (see batch.go).
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var chURL string
+var chTable string
+var chBatch int
+
+// chRow is one row of our table.
+type chRow struct {
+	Time     string  `json:"time"`
+	Host     string  `json:"host"`
+	Device   string  `json:"device"`
+	Interval float64 `json:"interval"`
+	RxBps    float64 `json:"rx_bps"`
+	TxBps    float64 `json:"tx_bps"`
+	RxPps    float64 `json:"rx_pps"`
+	TxPps    float64 `json:"tx_pps"`
+}
+
+// A chSink turns device intervals into rows for its batcher to
+// insert.
+type chSink struct {
+	url    string
+	host   string
+	client *http.Client
+	rows   *batcher[chRow]
+}
+
+func newCHSink(base, table string, batch int) (*chSink, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("'%s' is not an http or https URL", base)
+	}
+	q := u.Query()
+	q.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table))
+	u.RawQuery = q.Encode()
+
+	host, _ := os.Hostname()
+	cs := &chSink{
+		url:    u.String(),
+		host:   host,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	cs.rows = newBatcher("clickhouse", batch, cs.insert)
+	return cs, nil
+}
+
+// add adds a device's interval to the pending batch.
+func (cs *chSink) add(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	cs.rows.add(chRow{
+		Time:     dt.When.UTC().Format("2006-01-02 15:04:05.000"),
+		Host:     cs.host,
+		Device:   devname,
+		Interval: persec,
+		RxBps:    float64(dt.RBytes) / persec,
+		TxBps:    float64(dt.TBytes) / persec,
+		RxPps:    float64(dt.RPackets) / persec,
+		TxPps:    float64(dt.TPackets) / persec,
+	})
+}
+
+// flush is called at the end of every interval.
+func (cs *chSink) flush() { cs.rows.flush() }
+
+// close inserts what's left when we stop.
+func (cs *chSink) close() { cs.rows.close() }
+
+func (cs *chSink) insert(rows []chRow) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range rows {
+		if err := enc.Encode(&rows[i]); err != nil {
+			return err
+		}
+	}
+	resp, err := cs.client.Post(cs.url, "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
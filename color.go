@@ -0,0 +1,99 @@
+//
+// Heat coloring of rates (-color), so that busy and saturated links
+// stand out. Each RX and TX rate is green, yellow or red depending on
+// where it is against two -color-levels, which are either rates
+// ('10MB/s,100MB/s') or percentages of the device's link speed
+// ('50%,80%', the default). Devices with no known link speed aren't
+// colored when the levels are percentages.
+//
+// With -color=auto we only color if we're writing plain text to a
+// terminal, and NO_COLOR isn't set.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var colorMode string
+var colorLevels string
+var useColor bool
+
+// The levels, as bytes/sec or as fractions of link speed.
+var heatPct bool
+var heatWarn, heatCrit float64
+
+const (
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorReset  = "\x1b[0m"
+)
+
+// setupColor decides whether we're coloring and parses the levels.
+func setupColor() error {
+	switch colorMode {
+	case "never":
+		return nil
+	case "always":
+		useColor = true
+	case "auto":
+		fi, err := os.Stdout.Stat()
+		useColor = err == nil && fi.Mode()&os.ModeCharDevice != 0 &&
+			out == os.Stdout && formatName == "text" &&
+			os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	default:
+		return fmt.Errorf("-color must be never, auto or always")
+	}
+
+	lv := strings.Split(colorLevels, ",")
+	if len(lv) != 2 {
+		return fmt.Errorf("-color-levels must be two levels, warning and critical")
+	}
+	var err error
+	if strings.HasSuffix(lv[0], "%") && strings.HasSuffix(lv[1], "%") {
+		heatPct = true
+		if heatWarn, err = strconv.ParseFloat(strings.TrimSuffix(lv[0], "%"), 64); err == nil {
+			heatCrit, err = strconv.ParseFloat(strings.TrimSuffix(lv[1], "%"), 64)
+		}
+		heatWarn /= 100
+		heatCrit /= 100
+	} else if heatWarn, err = parseRate(lv[0]); err == nil {
+		heatCrit, err = parseRate(lv[1])
+	}
+	if err != nil {
+		return fmt.Errorf("bad -color-levels: %s", err)
+	}
+	if heatWarn > heatCrit {
+		return fmt.Errorf("-color-levels must be warning then critical")
+	}
+	return nil
+}
+
+// heat returns a formatted rate colored for a device, if we're
+// coloring.
+func heat(devname string, rate float64, s string) string {
+	if !useColor {
+		return s
+	}
+	warn, crit := heatWarn, heatCrit
+	if heatPct {
+		speed := linkSpeed(devname)
+		if speed == 0 {
+			return s
+		}
+		warn, crit = warn*speed, crit*speed
+	}
+	c := colorGreen
+	switch {
+	case rate >= crit:
+		c = colorRed
+	case rate >= warn:
+		c = colorYellow
+	}
+	return c + s + colorReset
+}
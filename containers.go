@@ -0,0 +1,164 @@
+//
+// Watching Docker (or Podman) containers by name or ID (-container).
+// We ask the Docker API for the container's main process, then look
+// at the container's own /sys/class/net (through /proc/<pid>/root)
+// for its devices and their iflink, which is the ifindex of the host
+// side veth. Reports then label that veth with the container's name
+// instead of the opaque vethXXXX.
+//
+// This needs to be able to talk to the Docker socket and to look into
+// the container's filesystem, which generally means running as root.
+// Containers using the host's network have no veth to find.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var containerNames string
+
+// devLabels maps host devices to what we call them in reports.
+var devLabels = make(map[string]string)
+
+// devLabel is what we call a device in reports.
+func devLabel(dev string) string {
+	if a, ok := devAliases[dev]; ok {
+		return a
+	}
+	if l, ok := devLabels[dev]; ok {
+		return l
+	}
+	return dev
+}
+
+// dockerSocket is the Docker API's Unix socket, which DOCKER_HOST
+// can change.
+func dockerSocket() string {
+	if h := os.Getenv("DOCKER_HOST"); strings.HasPrefix(h, "unix://") {
+		return strings.TrimPrefix(h, "unix://")
+	}
+	return "/var/run/docker.sock"
+}
+
+// containerPid asks Docker for a running container's name and the
+// process ID of its main process.
+func containerPid(name string) (string, int, error) {
+	sock := dockerSocket()
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+	resp, err := client.Get("http://docker/containers/" + url.PathEscape(name) + "/json")
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", 0, fmt.Errorf("no such container")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("unexpected API response: %s", resp.Status)
+	}
+	var info struct {
+		Name  string
+		State struct {
+			Pid int
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", 0, err
+	}
+	if info.State.Pid == 0 {
+		return "", 0, fmt.Errorf("not running")
+	}
+	return strings.TrimPrefix(info.Name, "/"), info.State.Pid, nil
+}
+
+// containerPeers returns the ifindexes of the host side of a
+// process's network devices, keyed by their name inside it.
+func containerPeers(pid int) (map[string]int, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid), "root", "sys", "class", "net")
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[string]int)
+	for _, fi := range fis {
+		read := func(attr string) int {
+			b, _ := ioutil.ReadFile(filepath.Join(dir, fi.Name(), attr))
+			n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+			return n
+		}
+		// A device whose iflink is itself isn't a veth.
+		il := read("iflink")
+		if il != 0 && il != read("ifindex") {
+			peers[fi.Name()] = il
+		}
+	}
+	return peers, nil
+}
+
+// containerDevices finds the host devices for a comma-separated list
+// of containers, and sets up their labels. A container with several
+// devices gets them labeled '<container>/<device>'.
+func containerDevices(ni *netInfo, names string) ([]string, error) {
+	byIndex := make(map[int]string)
+	for dev, idx := range ni.ifindex {
+		byIndex[idx] = dev
+	}
+	var devs []string
+	for _, name := range strings.Split(names, ",") {
+		if name == "" {
+			continue
+		}
+		cname, pid, err := containerPid(name)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", name, err)
+		}
+		peers, err := containerPeers(pid)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", name, err)
+		}
+		var inside []string
+		for in := range peers {
+			inside = append(inside, in)
+		}
+		sort.Strings(inside)
+		found := 0
+		for _, in := range inside {
+			dev, ok := byIndex[peers[in]]
+			if !ok {
+				continue
+			}
+			devs = append(devs, dev)
+			devLabels[dev] = cname + "/" + in
+			found++
+		}
+		if found == 0 {
+			return nil, noDevices(fmt.Sprintf("container %s: no veth devices found (is it using the host network?)", name))
+		}
+		if found == 1 {
+			devLabels[devs[len(devs)-1]] = cname
+		}
+	}
+	return devs, nil
+}
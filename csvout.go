@@ -0,0 +1,61 @@
+//
+// CSV output (-csv), for importing captures straight into
+// spreadsheets and pandas. There's one row per device per interval,
+// under a header line. Before that is a '#' comment line with our
+// version (pandas wants comment='#'). Rates are per second and the
+// interval is in seconds.
+//
+
+package main
+
+import (
+	"encoding/csv"
+	"strconv"
+	"time"
+)
+
+var csvOut bool
+
+const csvHeader = "time,device,ifindex,interval,rx_bps,tx_bps,rx_pps,tx_pps\n"
+
+// csvTime is our timestamp format, which is RFC 3339 with
+// milliseconds.
+const csvTime = "2006-01-02T15:04:05.000Z07:00"
+
+func fmtFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// printCSV writes a CSV row for a device's interval.
+func printCSV(devname string, dt DevDelta, ex lineExtras) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	w := csv.NewWriter(out)
+	w.Write([]string{
+		dt.When.Format(csvTime),
+		devname,
+		strconv.Itoa(ex.ifindex),
+		fmtFloat(persec),
+		fmtFloat(float64(dt.RBytes) / persec),
+		fmtFloat(float64(dt.TBytes) / persec),
+		fmtFloat(float64(dt.RPackets) / persec),
+		fmtFloat(float64(dt.TPackets) / persec),
+	})
+	w.Flush()
+}
+
+// csvFormat is the formatter for CSV.
+type csvFormat struct{}
+
+func (csvFormat) begin(when time.Time) {}
+
+func (csvFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	printCSV(devname, dt, ex)
+}
+
+func (csvFormat) end() {}
+func (csvFormat) header() string {
+	if !versionHeader {
+		return csvHeader
+	}
+	return "# " + versionLine() + "\n" + csvHeader
+}
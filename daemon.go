@@ -0,0 +1,168 @@
+//
+// Running as a service (-daemon). A daemon has nobody watching its
+// terminal, so there's no color or screen drawing, and unless you pick
+// a -format or send reports somewhere else, they're JSON lines, which
+// the journal or whatever collects our standard output can keep
+// structured. Under systemd with Type=notify, we tell it when we're
+// up and running, ping its watchdog after every report if it has one
+// for us, and say when we're stopping.
+//
+// -listen and -serve can be socket activated. If systemd passes us a
+// socket (LISTEN_FDS), we serve on it instead of listening on the
+// address we were given.
+//
+// -print-unit prints a systemd unit file that runs netvolmon as a
+// daemon with the rest of the command line's options, as a start.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var daemonMode, printUnit bool
+
+// setupDaemon adjusts our options for -daemon. It has to happen
+// before we settle on the output format.
+func setupDaemon() {
+	if screenMode || tuiMode || alertBell || alertHighlight {
+		fatal("-daemon can't be combined with -S, -tui, -bell or -highlight")
+	}
+	colorMode = "never"
+	if formatName == "text" && !jsonOut && !csvOut && !influxOut &&
+		listenAddr == "" && syslogWhat != "reports" && journalWhat != "reports" {
+		jsonOut = true
+	}
+}
+
+// sdNotify tells systemd about our state, if it wants to know.
+func sdNotify(state string) {
+	sock := os.Getenv("NOTIFY_SOCKET")
+	if sock == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", sock)
+	if err != nil {
+		log.Print("cannot notify systemd: ", err)
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+// sdListenFdsStart is the first file descriptor that systemd passes
+// sockets to us on.
+const sdListenFdsStart = 3
+
+// listen listens on addr, unless systemd has passed us a socket to
+// use instead. We only ever want one, so if there are more we use the
+// first.
+func listen(addr string) (net.Listener, error) {
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return net.Listen("tcp", addr)
+	}
+	// The sockets are only ours if systemd says they're for us.
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return net.Listen("tcp", addr)
+	}
+	// Nothing we run should think that these are for it.
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		log.Printf("systemd passed us %d sockets; using the first", n)
+	}
+	f := os.NewFile(sdListenFdsStart, "systemd socket")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd's socket: %w", err)
+	}
+	return l, nil
+}
+
+// watchdogEvery is how often systemd wants to hear from us, if at all.
+func watchdogEvery() time.Duration {
+	if p := os.Getenv("WATCHDOG_PID"); p != "" && p != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// startDaemon tells systemd that we're ready, and arranges to tell it
+// when we stop.
+func startDaemon() {
+	if wd := watchdogEvery(); wd > 0 && wd < 2*duration {
+		log.Printf("warning: systemd's watchdog wants to hear from us every %s, but we only report every %s", wd, duration)
+	}
+	sdNotify("READY=1")
+	atExit(func() { sdNotify("STOPPING=1") })
+}
+
+// sdWatchdog pings systemd's watchdog after a report.
+func sdWatchdog() {
+	if daemonMode && watchdogEvery() > 0 {
+		sdNotify("WATCHDOG=1")
+	}
+}
+
+// unitQuote quotes an argument for a unit file's ExecStart, if it
+// needs it.
+func unitQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"';") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// printUnitFile prints a unit file for running with the rest of our
+// command line.
+func printUnitFile() {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "/usr/local/bin/netvolmon"
+	}
+	cmd := []string{unitQuote(exe), "-daemon"}
+	for _, a := range os.Args[1:] {
+		name := strings.TrimLeft(a, "-")
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		switch name {
+		case "print-unit", "daemon":
+			continue
+		}
+		cmd = append(cmd, unitQuote(a))
+	}
+	watchdog := 3 * duration
+	if watchdog < 30*time.Second {
+		watchdog = 30 * time.Second
+	}
+	fmt.Printf(`[Unit]
+Description=netvolmon network traffic collector
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+WatchdogSec=%d
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`, strings.Join(cmd, " "), int(watchdog.Round(time.Second)/time.Second))
+}
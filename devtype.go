@@ -0,0 +1,98 @@
+//
+// Matching devices by what sort of device they are, with specifiers
+// like '@bridge' or '@physical'. This classifies devices through
+// Linux's /sys/class/net, so on other systems (and for devices that
+// sysfs doesn't know about) nothing matches.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// devTypes are our device types and how to tell if a device is one.
+var devTypes = map[string]func(dev string) bool{
+	"bridge":   func(dev string) bool { return sysfsHas(dev, "bridge") },
+	"bond":     func(dev string) bool { return sysfsHas(dev, "bonding") },
+	"vlan":     func(dev string) bool { return devType(dev) == "vlan" },
+	"veth":     isVeth,
+	"physical": func(dev string) bool { return sysfsHas(dev, "device") },
+	"virtual": func(dev string) bool {
+		return !sysfsHas(dev, "device") && sysfsNetAttr(dev, "type") != ""
+	},
+}
+
+// devTypeHelp is what -L says about each type.
+var devTypeHelp = map[string]string{
+	"bridge":   "bridges",
+	"bond":     "bonding masters",
+	"vlan":     "VLAN devices",
+	"veth":     "veth (virtual ethernet pair) devices",
+	"physical": "devices backed by real hardware",
+	"virtual":  "devices that aren't (bridges, tunnels, veths, lo, ...)",
+}
+
+func devTypeNames() []string {
+	names := sortedKeys(devTypes)
+	return names
+}
+
+// sysfsHas reports whether a device's sysfs directory has an entry.
+func sysfsHas(dev, name string) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/net", dev, name))
+	return err == nil
+}
+
+// devType returns the DEVTYPE from a device's uevent file, if it has
+// one. Many kinds of virtual devices do.
+func devType(dev string) string {
+	for _, l := range strings.Split(sysfsNetAttr(dev, "uevent"), "\n") {
+		if strings.HasPrefix(l, "DEVTYPE=") {
+			return l[len("DEVTYPE="):]
+		}
+	}
+	return ""
+}
+
+// isVeth recognizes veth devices. They have no DEVTYPE of their own,
+// but they're virtual ethernet devices whose iflink is their peer
+// rather than themselves.
+func isVeth(dev string) bool {
+	if sysfsHas(dev, "device") || devType(dev) != "" || sysfsNetAttr(dev, "type") != "1" {
+		return false
+	}
+	il := sysfsNetAttr(dev, "iflink")
+	return il != "" && il != sysfsNetAttr(dev, "ifindex")
+}
+
+// checkDevType checks that '@type' is a type we know.
+func checkDevType(devpat string) error {
+	if _, ok := devTypes[devpat[1:]]; !ok {
+		return fmt.Errorf("unknown device type '%s'; known ones are @%s", devpat, strings.Join(devTypeNames(), " @"))
+	}
+	return nil
+}
+
+// typeMatch matches '@type' against the names of network devices.
+// Unknown types were rejected by checkSpec, and match nothing.
+func typeMatch(devpat string, netdevs []string, tgt set[string]) bool {
+	if len(devpat) < 2 || devpat[0] != '@' {
+		return false
+	}
+	is, ok := devTypes[devpat[1:]]
+	if !ok {
+		return false
+	}
+	matched := false
+	for _, dev := range netdevs {
+		if is(dev) {
+			matched = true
+			tgt.add(dev)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,85 @@
+//
+// NIC driver statistics (-ethtool devs). /proc/net/dev only has the
+// generic counters, and it lumps a lot of interesting things into
+// them or leaves them out entirely; the driver usually knows about
+// missed packets, FIFO overruns, per-ring drops and so on. After each
+// interval's devices, we list every driver statistic of the -ethtool
+// devices that changed in it, with how much and how fast.
+//
+// What statistics there are and what they're called is entirely up
+// to the driver; 'ethtool -S <dev>' will show you.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ethtoolDevs string
+
+type ethtoolSample struct {
+	when  time.Time
+	stats map[string]uint64
+}
+
+var ethtoolList []string
+var lastEthtool = make(map[string]ethtoolSample)
+
+// startEthtool takes the first sample of each device's statistics,
+// which also checks that we can get them at all.
+func startEthtool() error {
+	for _, dev := range strings.Split(ethtoolDevs, ",") {
+		dev = strings.TrimSpace(dev)
+		if dev == "" {
+			continue
+		}
+		st, err := ethtoolStats(dev)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dev, err)
+		}
+		if len(st) == 0 {
+			return fmt.Errorf("%s: its driver has no statistics", dev)
+		}
+		ethtoolList = append(ethtoolList, dev)
+		lastEthtool[dev] = ethtoolSample{time.Now(), st}
+	}
+	if len(ethtoolList) == 0 {
+		return fmt.Errorf("no devices given")
+	}
+	return nil
+}
+
+// printEthtool prints what changed in the driver statistics of the
+// -ethtool devices since last time, indented under the devices.
+func printEthtool() {
+	for _, dev := range ethtoolList {
+		st, err := ethtoolStats(dev)
+		if err != nil {
+			log.Printf("-ethtool: %s: %s", dev, err)
+			continue
+		}
+		now := time.Now()
+		old := lastEthtool[dev]
+		lastEthtool[dev] = ethtoolSample{now, st}
+		secs := now.Sub(old.when).Seconds()
+
+		var names []string
+		for name, v := range st {
+			// Counters that went backwards were reset, so we
+			// have nothing to say about them this time.
+			if ov, ok := old.stats[name]; ok && v > ov {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d := st[name] - old.stats[name]
+			fmt.Fprintf(out, "   %s %-28s %+12d %12.1f/s\n", dev, name+":", d, float64(d)/secs)
+		}
+	}
+}
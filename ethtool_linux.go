@@ -0,0 +1,91 @@
+//
+// Reading a NIC's driver statistics on Linux, the same ones that
+// 'ethtool -S' shows, through the SIOCETHTOOL ioctl. Every driver has
+// its own set of them with its own names.
+//
+
+package main
+
+import (
+	"bytes"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	siocEthtool     = 0x8946
+	ethtoolGDrvInfo = 0x03
+	ethtoolGStrings = 0x1b
+	ethtoolGStats   = 0x1d
+	ethSSStats      = 1
+	ethGStringLen   = 32
+	// struct ethtool_drvinfo is 196 bytes, with n_stats at 180.
+	drvInfoLen    = 196
+	drvInfoNStats = 180
+)
+
+// ifreq is struct ifreq as SIOCETHTOOL uses it, with a pointer to
+// the ethtool command in its union.
+type ifreq struct {
+	name [16]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+func ethtoolIoctl(fd int, dev string, cmd []byte) error {
+	var ifr ifreq
+	copy(ifr.name[:len(ifr.name)-1], dev)
+	ifr.data = unsafe.Pointer(&cmd[0])
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ethtoolStats returns a device's driver statistics by name.
+func ethtoolStats(dev string) (map[string]uint64, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	info := make([]byte, drvInfoLen)
+	hostEndian.PutUint32(info, ethtoolGDrvInfo)
+	if err := ethtoolIoctl(fd, dev, info); err != nil {
+		return nil, err
+	}
+	n := int(hostEndian.Uint32(info[drvInfoNStats:]))
+	if n == 0 {
+		return map[string]uint64{}, nil
+	}
+
+	strs := make([]byte, 12+n*ethGStringLen)
+	hostEndian.PutUint32(strs[0:], ethtoolGStrings)
+	hostEndian.PutUint32(strs[4:], ethSSStats)
+	hostEndian.PutUint32(strs[8:], uint32(n))
+	if err := ethtoolIoctl(fd, dev, strs); err != nil {
+		return nil, err
+	}
+	vals := make([]byte, 8+n*8)
+	hostEndian.PutUint32(vals[0:], ethtoolGStats)
+	hostEndian.PutUint32(vals[4:], uint32(n))
+	if err := ethtoolIoctl(fd, dev, vals); err != nil {
+		return nil, err
+	}
+
+	// The driver may have shrunk the count between our calls.
+	if got := int(hostEndian.Uint32(vals[4:])); got < n {
+		n = got
+	}
+	stats := make(map[string]uint64, n)
+	for i := 0; i < n; i++ {
+		name := strs[12+i*ethGStringLen : 12+(i+1)*ethGStringLen]
+		if z := bytes.IndexByte(name, 0); z >= 0 {
+			name = name[:z]
+		}
+		stats[string(name)] = hostEndian.Uint64(vals[8+i*8:])
+	}
+	return stats, nil
+}
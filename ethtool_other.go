@@ -0,0 +1,12 @@
+//
+// Only Linux has ethtool.
+//
+
+//go:build !linux
+// +build !linux
+
+package main
+
+func ethtoolStats(dev string) (map[string]uint64, error) {
+	return nil, unsupported("driver statistics are only available on Linux")
+}
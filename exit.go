@@ -0,0 +1,80 @@
+//
+// Exit statuses. Most things that go wrong are problems with how we
+// were run, which exit with status 1 through fatal or fatalf (or 2,
+// for ones the flag package catches), but wrapper scripts may want to
+// tell a few others apart:
+//
+//	3   no devices matched what we were asked to watch
+//	4   something isn't supported on this platform
+//	5   we weren't allowed to get the stats
+//	6   getting stats failed once we were running
+//
+// Errors carry which of these they are by being a noDevices or an
+// unsupported, or by wrapping netvol.ErrUnsupported or a permission
+// error, so they can pass through fmt.Errorf's %w on their way up.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/siebenmann/netvolmon/netvol"
+)
+
+const (
+	exitFailure     = 1
+	exitNoDevices   = 3
+	exitUnsupported = 4
+	exitPermission  = 5
+	exitCollection  = 6
+)
+
+// noDevices is an error for when device specifiers don't match
+// anything, or nothing is left to watch once they've been applied.
+type noDevices string
+
+func (e noDevices) Error() string { return string(e) }
+
+// unsupported is an error for something this platform can't do.
+type unsupported string
+
+func (e unsupported) Error() string { return string(e) }
+
+// exitCode is the exit status for an error, with def for when there's
+// nothing more specific to say about it.
+func exitCode(err error, def int) int {
+	var nd noDevices
+	var us unsupported
+	switch {
+	case errors.As(err, &nd):
+		return exitNoDevices
+	case errors.As(err, &us), errors.Is(err, netvol.ErrUnsupported):
+		return exitUnsupported
+	case errors.Is(err, os.ErrPermission):
+		return exitPermission
+	}
+	return def
+}
+
+// fatal is log.Fatal for problems with how we were run, and so exits
+// with exitFailure.
+func fatal(v ...interface{}) {
+	log.Output(2, fmt.Sprint(v...))
+	os.Exit(exitFailure)
+}
+
+// fatalf is fatal with formatting.
+func fatalf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(exitFailure)
+}
+
+// fatalErr is log.Fatal for an error, exiting with exitCode(err, def).
+func fatalErr(def int, what string, err error) {
+	log.Output(2, what+err.Error())
+	os.Exit(exitCode(err, def))
+}
@@ -4,21 +4,24 @@
 //
 // - plain network device names
 // - globbed network device names
+// - regular expressions for network device names, written '~regexp'
+// - types of network devices, like '@bridge' (see devtype.go)
 // - ip addresses (which must exactly match an IP address of one or more
 //   interfaces)
 // - CIDR netblocks, which are matched against the IP addresses of
 //   interfaces
 // - wildcarded IP address patterns, like '127.*'
 //
-// BUGS: desperately needs tests and refactoring
+// BUGS: desperately needs refactoring
 
 package main
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net"
 	"os"
-	"sort"
+	"regexp"
 
 	"github.com/ryanuber/go-glob"
 )
@@ -26,7 +29,7 @@ import (
 // Match a glob pattern against the names of network devices.
 // We take the target map to add entries to because we may match multiple
 // entries. In fact that's kind of the default case.
-func globMatch(devpat string, netdevs []string, tgt set) bool {
+func globMatch(devpat string, netdevs []string, tgt set[string]) bool {
 	matched := false
 	for _, dev := range netdevs {
 		if glob.Glob(devpat, dev) {
@@ -37,6 +40,35 @@ func globMatch(devpat string, netdevs []string, tgt set) bool {
 	return matched
 }
 
+// specRegexps are the compiled regexps of '~regexp' specifiers, from
+// checkSpec.
+var specRegexps = make(map[string]*regexp.Regexp)
+
+// Match a '~regexp' against the names of network devices. Unlike
+// globs, the regexp isn't anchored unless you anchor it. Specifiers
+// are checked (and their regexps compiled) when we start, so a bad
+// one here just doesn't match.
+func regexpMatch(devpat string, netdevs []string, tgt set[string]) bool {
+	if len(devpat) < 2 || devpat[0] != '~' {
+		return false
+	}
+	re, ok := specRegexps[devpat]
+	if !ok {
+		if checkSpec(devpat) != nil {
+			return false
+		}
+		re = specRegexps[devpat]
+	}
+	matched := false
+	for _, dev := range netdevs {
+		if re.MatchString(dev) {
+			matched = true
+			tgt.add(dev)
+		}
+	}
+	return matched
+}
+
 // ----
 // IP based matching
 
@@ -61,14 +93,7 @@ func (im ipMap) add(ip, netdev string) {
 // members returns a (sorted) list of the keys of an ipMap, by analogy
 // to the same operation on sets.
 func (im ipMap) members() []string {
-	keys := make([]string, len(im))
-	i := 0
-	for k := range im {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-	return keys
+	return sortedKeys(im)
 }
 
 // ipMatch is given an IP address (or a potential one) and finds it
@@ -76,7 +101,7 @@ func (im ipMap) members() []string {
 // eg '127.0.0.1' -> 'lo'
 // This will always only match a single ipmap entry, but that entry
 // might have multiple devices associated with it.
-func ipMatch(devpat string, ipmap ipMap, tgt set) bool {
+func ipMatch(devpat string, ipmap ipMap, tgt set[string]) bool {
 	ip := net.ParseIP(devpat)
 	if ip == nil {
 		return false
@@ -91,7 +116,7 @@ func ipMatch(devpat string, ipmap ipMap, tgt set) bool {
 // globIPMatch is given an IP address glob and matches it against the
 // IP addresses associated with network devices, adding all that match.
 // eg '127.*' -> 'lo'
-func globIPMatch(devpat string, ipmap ipMap, tgt set) bool {
+func globIPMatch(devpat string, ipmap ipMap, tgt set[string]) bool {
 	matched := false
 	for k, v := range ipmap {
 		if glob.Glob(devpat, k) {
@@ -105,7 +130,7 @@ func globIPMatch(devpat string, ipmap ipMap, tgt set) bool {
 // cidrIPMatch is given a CIDR and matches it against the IP addresses
 // associated with network devices, adding all that match.
 // eg '127.0.0.0/8' -> 'lo'.
-func cidrIPMatch(devpat string, ipmap ipMap, tgt set) bool {
+func cidrIPMatch(devpat string, ipmap ipMap, tgt set[string]) bool {
 	matched := false
 	_, cidr, err := net.ParseCIDR(devpat)
 	if err != nil {
@@ -124,7 +149,7 @@ func cidrIPMatch(devpat string, ipmap ipMap, tgt set) bool {
 // Match 'me' and try to translate it to an IP address via host lookup,
 // then find the IP address(es) in our devices.
 // TODO: try to pick one primary address? That gets complicated.
-func matchMe(devpat string, ipmap ipMap, tgt set) bool {
+func matchMe(devpat string, ipmap ipMap, tgt set[string]) bool {
 	if devpat != "me" {
 		return false
 	}
@@ -146,7 +171,7 @@ func matchMe(devpat string, ipmap ipMap, tgt set) bool {
 	return matched
 }
 
-func matchNetNames(devpat string, ipmap ipMap, tgt set) bool {
+func matchNetNames(devpat string, ipmap ipMap, tgt set[string]) bool {
 	if cidr, ok := cslabNetNames[devpat]; ok {
 		return cidrIPMatch(cidr, ipmap, tgt)
 	}
@@ -154,14 +179,12 @@ func matchNetNames(devpat string, ipmap ipMap, tgt set) bool {
 		// we match if any one of the multi-name matched,
 		// so we can have entries like 'blue' for 'net3 and/or
 		// net5'.
+		// Unknown names were rejected by checkNetNames when
+		// we started.
 		matched := false
 		for _, name := range slist {
 			cidr, ok := cslabNetNames[name]
-			if !ok {
-				// TODO: really this is a fatal error
-				return false
-			}
-			if cidrIPMatch(cidr, ipmap, tgt) {
+			if ok && cidrIPMatch(cidr, ipmap, tgt) {
 				matched = true
 			}
 		}
@@ -170,23 +193,78 @@ func matchNetNames(devpat string, ipmap ipMap, tgt set) bool {
 	return false
 }
 
+// checkSpec checks what it can of a device specifier without looking
+// at the network, compiling any regexp in it for regexpMatch.
+func checkSpec(spec string) error {
+	switch {
+	case spec == "":
+		return errors.New("empty device specifier")
+	case len(spec) > 1 && spec[0] == '~':
+		re, err := regexp.Compile(spec[1:])
+		if err != nil {
+			return fmt.Errorf("bad regular expression in '%s': %s", spec, err)
+		}
+		specRegexps[spec] = re
+	case len(spec) > 1 && spec[0] == '@':
+		return checkDevType(spec)
+	}
+	return nil
+}
+
+// checkSpecs checks the device specifiers we were given and -x's,
+// so that we find out about bad ones now rather than when they're
+// first used, which may be in the middle of a run.
+func checkSpecs(devices, exlist []string) error {
+	for _, s := range devices {
+		if err := checkSpec(s); err != nil {
+			return err
+		}
+	}
+	for _, s := range exlist {
+		if err := checkSpec(s); s != "" && err != nil {
+			return fmt.Errorf("-x: %w", err)
+		}
+	}
+	return nil
+}
+
+// matchSpec tries all of our complicated matching for a device
+// specifier, adding everything that matches to tgt. The order is
+// basically from what we think is probably the cheapest to the most
+// expensive. It's probably wrong.
+//
+// All matchers return 'true' if they match something, 'false'
+// otherwise. First one to hit wins.
+func matchSpec(ni *netInfo, k string, devs []string, tgt set[string]) bool {
+	// We deliberately start out with our special magic
+	// matches.
+	return matchMe(k, ni.ipmap, tgt) ||
+		matchNetNames(k, ni.ipmap, tgt) ||
+		typeMatch(k, devs, tgt) ||
+		regexpMatch(k, devs, tgt) ||
+		globMatch(k, devs, tgt) ||
+		ipMatch(k, ni.ipmap, tgt) ||
+		cidrIPMatch(k, ni.ipmap, tgt) ||
+		globIPMatch(k, ni.ipmap, tgt)
+}
+
 // expandDevList takes a list of network device names from the command
 // line, plus the starting stats structure, and attempts to find actual
 // network device names for all of the arguments. It does various sorts
-// of matching.
+// of matching. It's an error for an argument not to match anything.
 //
 // BUGS: we assume the network device name list from oldst matches the
 // network device names that net.Interfaces() will return in Interfaces
 // structures.
-func expandDevList(devices []string, oldst Stats, exlist []string) []string {
+func expandDevList(ni *netInfo, devices []string, oldst Stats, excl *excluder) ([]string, error) {
 	// We cannot simply put matching devices in a list, because
 	// multiple command line arguments may match an overlapping
 	// set of devices and we don't want repeated device names.
 	// So we must put them in a set (here a string-based map)
 	// and then turn them into an array at the end.
-	nk := make(set)
+	nk := make(set[string])
 
-	devs := oldst.members()
+	devs := oldst.Members()
 
 	// Try multiple strategies to find network devices for each
 	// command line argument.
@@ -198,33 +276,65 @@ func expandDevList(devices []string, oldst Stats, exlist []string) []string {
 			nk.add(k)
 			continue
 		}
+		// Or it may be another name for one.
+		if dev, ok := ni.altnames[k]; ok {
+			if _, ok := oldst[dev]; ok {
+				nk.add(dev)
+				continue
+			}
+		}
 
-		// Try all of our complicated matching. The order is
-		// basically from what we think is probably the cheapest
-		// to the most expensive. It's probably wrong.
-		//
-		// All matchers return 'true' if they match something,
-		// 'false' otherwise. First one to hit wins.
-		//
-		// We deliberately start out with our special magic
-		// matches.
-		if matchMe(k, netinfo.ipmap, nk) ||
-			matchNetNames(k, netinfo.ipmap, nk) ||
-			globMatch(k, devs, nk) ||
-			ipMatch(k, netinfo.ipmap, nk) ||
-			cidrIPMatch(k, netinfo.ipmap, nk) ||
-			globIPMatch(k, netinfo.ipmap, nk) {
+		if matchSpec(ni, k, devs, nk) {
 			continue
 		}
 
 		// No match? Fail here.
-		log.Fatalf("device specifier '%s' doesn't seem to exist or match anything", k)
+		return nil, noDevices(fmt.Sprintf("device specifier '%s' doesn't seem to exist or match anything", k))
 	}
 
 	// Turn our 'nk' set of matched network device names into a
 	// sorted list, first removing excluded devices.
-	for _, k := range exlist {
-		nk.remove(k)
+	for k := range nk {
+		if excl.isin(k) {
+			nk.remove(k)
+		}
+	}
+	return nk.members(), nil
+}
+
+// An excluder decides whether devices are excluded by -x (and -P).
+// Exclusions can be any device specifier, and we check each device
+// against them the first time we see it, so that '-x veth*' excludes
+// veth devices that appear after we start.
+type excluder struct {
+	ni    *netInfo
+	specs []string
+	known map[string]bool
+}
+
+func newExcluder(ni *netInfo, specs []string) *excluder {
+	x := &excluder{ni: ni, known: make(map[string]bool)}
+	for _, s := range specs {
+		if s != "" {
+			x.specs = append(x.specs, s)
+		}
+	}
+	return x
+}
+
+// isin reports whether the device is excluded.
+func (x *excluder) isin(dev string) bool {
+	if v, ok := x.known[dev]; ok {
+		return v
+	}
+	excluded := false
+	for _, s := range x.specs {
+		tgt := make(set[string])
+		if s == dev || (matchSpec(x.ni, s, []string{dev}, tgt) && tgt.isin(dev)) {
+			excluded = true
+			break
+		}
 	}
-	return nk.members()
+	x.known[dev] = excluded
+	return excluded
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDevStats is some devices with traffic, and one without, and
+// their netinfo with IPs and an altname.
+func testDevStats(t *testing.T) (*netInfo, Stats) {
+	t.Cleanup(func() {
+		onlyDevices = nil
+		devGroups = nil
+	})
+	ni := newNetinfo()
+	ni.loopbacks.add("lo")
+	ni.ipmap.add("127.0.0.1", "lo")
+	ni.ipmap.add("192.0.2.1", "eth0")
+	ni.ipmap.add("192.0.2.2", "eth1")
+	ni.ipmap.add("198.51.100.1", "wlan0")
+	ni.altnames["enp1s0"] = "eth0"
+	return ni, Stats{
+		"lo":       {RBytes: 100},
+		"eth0":     {RBytes: 100},
+		"eth1":     {RBytes: 100},
+		"eth1.100": {RBytes: 100},
+		"wlan0":    {RBytes: 100},
+		"dummy0":   {},
+	}
+}
+
+func TestExpandDevList(t *testing.T) {
+	ni, st := testDevStats(t)
+	tests := []struct {
+		specs   string
+		exclude string
+		want    []string
+	}{
+		{"eth0", "", []string{"eth0"}},
+		{"eth0,eth0,eth1", "", []string{"eth0", "eth1"}},
+		{"enp1s0", "", []string{"eth0"}},
+		{"eth*", "", []string{"eth0", "eth1", "eth1.100"}},
+		{"eth*", "eth1*", []string{"eth0"}},
+		{"~^eth[0-9]+$", "", []string{"eth0", "eth1"}},
+		{"~lan", "", []string{"wlan0"}},
+		{"192.0.2.2", "", []string{"eth1"}},
+		{"192.0.2.*", "", []string{"eth0", "eth1"}},
+		{"192.0.2.0/24,198.51.100.0/24", "", []string{"eth0", "eth1", "wlan0"}},
+		{"127.*,dummy0", "", []string{"dummy0", "lo"}},
+		{"eth*", "192.0.2.1", []string{"eth1", "eth1.100"}},
+	}
+	for _, tc := range tests {
+		var exlist []string
+		if tc.exclude != "" {
+			exlist = strings.Split(tc.exclude, ",")
+		}
+		specs := strings.Split(tc.specs, ",")
+		if err := checkSpecs(specs, exlist); err != nil {
+			t.Errorf("%s: %s", tc.specs, err)
+			continue
+		}
+		got, err := expandDevList(ni, specs, st, newExcluder(ni, exlist))
+		if err != nil {
+			t.Errorf("%s -x %s: %s", tc.specs, tc.exclude, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s -x %s: got %v, want %v", tc.specs, tc.exclude, got, tc.want)
+		}
+	}
+}
+
+func TestExpandDevListNoMatch(t *testing.T) {
+	ni, st := testDevStats(t)
+	for _, specs := range []string{"eth9", "eth0,ppp*", "10.0.0.1", "10.0.0.0/8", "~^ppp"} {
+		_, err := expandDevList(ni, strings.Split(specs, ","), st, newExcluder(ni, nil))
+		if err == nil {
+			t.Errorf("%s: matched something", specs)
+			continue
+		}
+		if code := exitCode(err, exitFailure); code != exitNoDevices {
+			t.Errorf("%s: exit code %d, want %d", specs, code, exitNoDevices)
+		}
+	}
+}
+
+func TestChooseDevices(t *testing.T) {
+	ni, st := testDevStats(t)
+	tests := []struct {
+		name    string
+		specs   []string
+		exclude []string
+		incLo   bool
+		noPtP   bool
+		want    []string
+	}{
+		{"everything", nil, nil, false, false, []string{"eth0", "eth1", "eth1.100", "wlan0"}},
+		{"everything with -l", nil, nil, true, false, []string{"eth0", "eth1", "eth1.100", "lo", "wlan0"}},
+		{"everything with -x", nil, []string{"eth1*"}, false, false, []string{"eth0", "wlan0"}},
+		{"given", []string{"lo", "wlan0"}, nil, false, false, []string{"lo", "wlan0"}},
+		{"given with -x", []string{"eth*"}, []string{"eth1.100"}, false, false, []string{"eth0", "eth1"}},
+		{"-P", []string{"eth*", "wlan0"}, nil, false, true, []string{"eth0", "eth1", "eth1.100"}},
+	}
+	ni.pointtopoint.add("wlan0")
+	for _, tc := range tests {
+		cfg := newConfig()
+		cfg.netinfo = ni
+		cfg.incLo = tc.incLo
+		got, err := chooseDevices(cfg, tc.specs, st, makeExcluder(cfg, tc.exclude, tc.noPtP))
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestChooseDevicesNone(t *testing.T) {
+	ni, st := testDevStats(t)
+	tests := []struct {
+		name    string
+		specs   []string
+		exclude []string
+	}{
+		{"everything excluded", nil, []string{"*"}},
+		{"all given excluded", []string{"eth*"}, []string{"eth*"}},
+		{"no match", []string{"eth9"}, nil},
+	}
+	for _, tc := range tests {
+		cfg := newConfig()
+		cfg.netinfo = ni
+		_, err := chooseDevices(cfg, tc.specs, st, makeExcluder(cfg, tc.exclude, false))
+		if code := exitCode(err, exitFailure); code != exitNoDevices {
+			t.Errorf("%s: error %v, exit code %d, want %d", tc.name, err, code, exitNoDevices)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+//
+// Output formats. reportDeltas hands every device's interval to a
+// formatter, which writes it out however it likes. Adding a format
+// means writing a formatter and adding it to formatters; nothing in
+// the reporting loop has to change.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A formatter writes out our reports, one interval at a time. begin
+// is called at the start of every interval and end at the end of it,
+// with device called for every device (or group, or total) line in
+// between, along with the config of the monitor reporting it.
+type formatter interface {
+	begin(when time.Time)
+	device(c *config, devname string, dt DevDelta, ex lineExtras)
+	end()
+	// header is written at the start of output, including at the
+	// start of every new -o file.
+	header() string
+}
+
+// formatters are our output formats by -format name.
+var formatters = map[string]formatter{
+	"text":   &textFormat{},
+	"json":   &jsonFormat{},
+	"csv":    csvFormat{},
+	"influx": influxFormat{},
+	"zabbix": zabbixFormat{},
+}
+
+var formatName = "text"
+
+// outFormat is how we're writing our reports.
+var outFormat formatter
+
+func formatNames() []string {
+	names := sortedKeys(formatters)
+	return names
+}
+
+// textFormat is our normal human readable output, including -S's
+// redrawn screen.
+type textFormat struct {
+	reported bool
+	// lines counts device lines, for -H.
+	lines int
+}
+
+func (tf *textFormat) begin(when time.Time) {
+	tf.reported = false
+	if screenMode {
+		screenStart(out, when)
+	}
+}
+
+func (tf *textFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	tf.reported = true
+	if headerEvery > 0 && tf.lines%headerEvery == 0 {
+		fmt.Fprintln(out, headerLine(c))
+	}
+	tf.lines++
+	printDelta(c, devname, dt, ex)
+}
+
+func (tf *textFormat) end() {
+	// We only produce a blank line if we actually reported
+	// on some network traffic this time around. Doing it
+	// any other way is far too annoying.
+	if tf.reported && blankline {
+		fmt.Fprintln(out)
+	}
+}
+
+func (tf *textFormat) header() string { return "" }
+
+// tuiFormat collects lines for -tui to draw.
+type tuiFormat struct {
+	when time.Time
+}
+
+func (tf *tuiFormat) begin(when time.Time) { tf.when = when }
+
+func (tf *tuiFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	tuiAdd(devname, dt, ex)
+}
+
+func (tf *tuiFormat) end()           { tuiFinish(tf.when) }
+func (tf *tuiFormat) header() string { return "" }
@@ -1,8 +1,9 @@
 module github.com/siebenmann/netvolmon
 
-go 1.15
+go 1.21
 
 require (
+	github.com/lib/pq v1.12.3
 	github.com/ryanuber/go-glob v1.0.0
 	github.com/siebenmann/go-kstat v0.0.0-20200303194639-4e8294f9e9d5
 )
@@ -0,0 +1,94 @@
+//
+// A Graphite sink (-graphite), so that netvolmon can double as a
+// quick ad-hoc carbon feeder. Every interval we push metrics like
+//
+//	netvolmon.<host>.<device>.rx_bytes <rate> <unix time>
+//
+// in carbon's plaintext protocol over TCP. The values are per second
+// rates, as usual. Dots in the host and device names would make extra
+// levels in the metric tree, so they become underscores.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var graphiteAddr string
+var graphitePrefix string
+
+// A graphiteSink accumulates an interval's metrics and sends them
+// all at once. We connect lazily and reconnect if a send fails, so
+// a carbon restart only costs us an interval or two.
+type graphiteSink struct {
+	addr   string
+	prefix string
+	conn   net.Conn
+	buf    bytes.Buffer
+}
+
+var graphiteName = strings.NewReplacer(".", "_", " ", "_", "/", "_")
+
+func newGraphiteSink(addr, prefix string) *graphiteSink {
+	host, _ := os.Hostname()
+	// Use the short host name; the domain is just noise here.
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &graphiteSink{addr: addr, prefix: prefix + graphiteName.Replace(host) + "."}
+}
+
+// add adds a device's interval to what we'll send.
+func (gs *graphiteSink) add(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	base := gs.prefix + graphiteName.Replace(devname) + "."
+	ts := dt.When.Unix()
+	put := func(name string, v uint64) {
+		fmt.Fprintf(&gs.buf, "%s%s %s %d\n", base, name, fmtFloat(float64(v)/persec), ts)
+	}
+	put("rx_bytes", dt.RBytes)
+	put("tx_bytes", dt.TBytes)
+	put("rx_packets", dt.RPackets)
+	put("tx_packets", dt.TPackets)
+}
+
+// flush sends everything accumulated this interval. Failures are
+// logged but not fatal, and the metrics are dropped.
+func (gs *graphiteSink) flush() {
+	if gs.buf.Len() == 0 {
+		return
+	}
+	defer gs.buf.Reset()
+	if gs.conn == nil {
+		c, err := net.DialTimeout("tcp", gs.addr, 5*time.Second)
+		if err != nil {
+			log.Print("cannot connect to graphite: ", err)
+			return
+		}
+		gs.conn = c
+	}
+	gs.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := gs.conn.Write(gs.buf.Bytes()); err != nil {
+		log.Print("sending to graphite failed: ", err)
+		gs.conn.Close()
+		gs.conn = nil
+	}
+}
+
+// close closes our connection, if we have one.
+func (gs *graphiteSink) close() {
+	if gs.conn != nil {
+		gs.conn.Close()
+		gs.conn = nil
+	}
+}
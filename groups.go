@@ -0,0 +1,96 @@
+//
+// Device groups (-group name=spec,spec,...). Each group gets its own
+// line every interval, with its member devices' traffic added up.
+// Members are found with the same device specifiers as the command
+// line, so '-group storage=10.1.2.0/24' works. Membership is settled
+// when we start (or reload on SIGHUP); devices that appear later
+// aren't added until then.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// groupFlags is the -group arguments, which may be repeated.
+type groupFlags []string
+
+func (g *groupFlags) String() string {
+	return strings.Join(*g, " ")
+}
+
+func (g *groupFlags) Set(v string) error {
+	eq := strings.IndexByte(v, '=')
+	if eq <= 0 || eq == len(v)-1 {
+		return fmt.Errorf("'%s' isn't name=devices", v)
+	}
+	*g = append(*g, v)
+	return nil
+}
+
+var groupArgs groupFlags
+
+type devGroup struct {
+	name    string
+	members []string
+}
+
+var devGroups []devGroup
+
+// setupGroups finds the members of all of our groups. It's an error
+// for a group's specifiers not to match anything.
+func setupGroups(ni *netInfo, oldst Stats, excl *excluder) error {
+	var groups []devGroup
+	for _, g := range groupArgs {
+		eq := strings.IndexByte(g, '=')
+		specs := strings.Split(g[eq+1:], ",")
+		members, err := expandDevList(ni, specs, oldst, excl)
+		if err != nil {
+			return fmt.Errorf("group %s: %w", g[:eq], err)
+		}
+		groups = append(groups, devGroup{
+			name:    g[:eq],
+			members: members,
+		})
+	}
+	devGroups = groups
+	return nil
+}
+
+// checkGroups checks our -group definitions without looking at the
+// network, returning everything that's wrong with them.
+func checkGroups() []error {
+	var errs []error
+	seen := make(set[string])
+	for _, g := range groupArgs {
+		eq := strings.IndexByte(g, '=')
+		name := g[:eq]
+		switch {
+		case seen.isin(name):
+			errs = append(errs, fmt.Errorf("group '%s' is defined more than once", name))
+		case name == totalName:
+			errs = append(errs, fmt.Errorf("group '%s' has the same name as the total line", name))
+		}
+		seen.add(name)
+		for _, spec := range strings.Split(g[eq+1:], ",") {
+			if err := checkSpec(spec); err != nil {
+				errs = append(errs, fmt.Errorf("group '%s': %w", name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// groupDelta adds up a group's interval. A group with none of its
+// devices in dt has a zero Delta.
+func groupDelta(g devGroup, dt Deltas) DevDelta {
+	var sum DevDelta
+	for _, m := range g.members {
+		if v, ok := dt[m]; ok {
+			addTotal(&sum, v)
+		}
+	}
+	return sum
+}
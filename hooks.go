@@ -0,0 +1,131 @@
+//
+// Script hooks (-exec-start, -exec-sample and -exec-stop), so people
+// can wire netvolmon into their own automation. Each hook is run with
+// 'sh -c' and gets a JSON description of the event on standard input,
+// plus the basics in the environment:
+//
+//	NETVOLMON_EVENT     start, sample or stop
+//	NETVOLMON_TIME      the time of the event, in RFC 3339 format
+//	NETVOLMON_DEVICES   space-separated devices involved
+//
+// The start and stop hooks are waited for, so that they can set up or
+// tear down things like packet captures. Sample hooks run in the
+// background, but only one at a time; if the previous one is still
+// going, we skip this interval's.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var execStart, execSample, execStop string
+
+// hookSample is the per-device data given to sample hooks. Rates are
+// per second.
+type hookSample struct {
+	Device   string  `json:"device"`
+	RxBps    float64 `json:"rx_bps"`
+	TxBps    float64 `json:"tx_bps"`
+	RxPps    float64 `json:"rx_pps"`
+	TxPps    float64 `json:"tx_pps"`
+	Interval float64 `json:"interval"`
+}
+
+// hookEvent is what hooks get on standard input.
+type hookEvent struct {
+	Event    string       `json:"event"`
+	Time     time.Time    `json:"time"`
+	Interval float64      `json:"interval"`
+	Devices  []string     `json:"devices"`
+	Samples  []hookSample `json:"samples,omitempty"`
+}
+
+func newHookSample(devname string, dt DevDelta) hookSample {
+	persec := float64(dt.Delta) / float64(time.Second)
+	return hookSample{
+		Device:   devname,
+		RxBps:    float64(dt.RBytes) / persec,
+		TxBps:    float64(dt.TBytes) / persec,
+		RxPps:    float64(dt.RPackets) / persec,
+		TxPps:    float64(dt.TPackets) / persec,
+		Interval: persec,
+	}
+}
+
+// hookCmd sets up the command for a hook and event.
+func hookCmd(cmdline string, ev hookEvent) *exec.Cmd {
+	data, _ := json.Marshal(ev)
+	cmd := exec.Command("sh", "-c", cmdline)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"NETVOLMON_EVENT="+ev.Event,
+		"NETVOLMON_TIME="+ev.Time.Format(time.RFC3339),
+		"NETVOLMON_DEVICES="+strings.Join(ev.Devices, " "))
+	return cmd
+}
+
+// runHook runs a start or stop hook and waits for it. Hook failures
+// are reported but aren't fatal.
+func runHook(cmdline, event string, devices []string) {
+	if cmdline == "" {
+		return
+	}
+	ev := hookEvent{
+		Event:    event,
+		Time:     time.Now(),
+		Interval: duration.Seconds(),
+		Devices:  devices,
+	}
+	if err := hookCmd(cmdline, ev).Run(); err != nil {
+		log.Printf("-exec-%s hook: %s", event, err)
+	}
+}
+
+var sampleHookMu sync.Mutex
+var sampleHookBusy bool
+
+// runSampleHook starts the sample hook for an interval in the
+// background, unless the last one is still running.
+func runSampleHook(when time.Time, samples []hookSample) {
+	sampleHookMu.Lock()
+	defer sampleHookMu.Unlock()
+	if sampleHookBusy {
+		log.Printf("-exec-sample hook still running, skipping this interval")
+		return
+	}
+
+	ev := hookEvent{
+		Event:    "sample",
+		Time:     when,
+		Interval: duration.Seconds(),
+		Samples:  samples,
+	}
+	for _, s := range samples {
+		ev.Devices = append(ev.Devices, s.Device)
+	}
+	cmd := hookCmd(execSample, ev)
+	if err := cmd.Start(); err != nil {
+		log.Printf("-exec-sample hook: %s", err)
+		return
+	}
+	sampleHookBusy = true
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("-exec-sample hook: %s", err)
+		}
+		sampleHookMu.Lock()
+		sampleHookBusy = false
+		sampleHookMu.Unlock()
+	}()
+}
@@ -0,0 +1,135 @@
+//
+// InfluxDB line protocol output (-influx), so that captures can be
+// fed straight into InfluxDB or Telegraf. There's one line per device
+// per interval:
+//
+//	netvolmon,host=<host>,device=<dev> interval=...,rx_bps=...,tx_bps=...,rx_pps=...,tx_pps=... <ns>
+//
+// Normally the lines go wherever our reports go, but with -influx-url
+// they're sent once an interval to a UDP listener (udp://host:port)
+// or POSTed to an HTTP write endpoint (an http or https URL). Output
+// starts with a comment line giving our version.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var influxOut bool
+var influxURL string
+
+// influxHost is our host tag.
+var influxHost string
+
+// If we're sending lines somewhere, they accumulate in influxBuf for
+// the interval and then influxSend sends them.
+var influxBuf bytes.Buffer
+var influxSend func([]byte) error
+
+// Tag values must have commas, spaces and equals signs escaped.
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// printInflux writes a line for a device's interval.
+func printInflux(devname string, dt DevDelta) {
+	var w io.Writer = out
+	if influxSend != nil {
+		w = &influxBuf
+	}
+	persec := float64(dt.Delta) / float64(time.Second)
+	fmt.Fprintf(w, "netvolmon,host=%s,device=%s interval=%s,rx_bps=%s,tx_bps=%s,rx_pps=%s,tx_pps=%s %d\n",
+		influxEscaper.Replace(influxHost),
+		influxEscaper.Replace(devname),
+		fmtFloat(persec),
+		fmtFloat(float64(dt.RBytes)/persec),
+		fmtFloat(float64(dt.TBytes)/persec),
+		fmtFloat(float64(dt.RPackets)/persec),
+		fmtFloat(float64(dt.TPackets)/persec),
+		dt.When.UnixNano())
+}
+
+// flushInflux sends this interval's lines, if we're sending them
+// anywhere. Failures are logged but not fatal; the lines are dropped,
+// since the next interval will have new ones.
+func flushInflux() {
+	if influxSend == nil || influxBuf.Len() == 0 {
+		return
+	}
+	if err := influxSend(influxBuf.Bytes()); err != nil {
+		log.Print("sending to InfluxDB failed: ", err)
+	}
+	influxBuf.Reset()
+}
+
+// setupInflux sets our host tag and, if there's an endpoint URL,
+// how we send to it.
+func setupInflux(endpoint string) error {
+	influxHost, _ = os.Hostname()
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return err
+		}
+		influxSend = func(b []byte) error {
+			_, err := conn.Write(b)
+			return err
+		}
+	case "http", "https":
+		client := &http.Client{Timeout: 10 * time.Second}
+		influxSend = func(b []byte) error {
+			resp, err := client.Post(endpoint, "text/plain; charset=utf-8", bytes.NewReader(b))
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+				return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("'%s' is not a udp, http or https URL", endpoint)
+	}
+	return nil
+}
+
+// influxFormat is the formatter for line protocol.
+type influxFormat struct{}
+
+func (influxFormat) begin(when time.Time) {}
+
+func (influxFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	printInflux(devname, dt)
+}
+
+func (influxFormat) end() { flushInflux() }
+
+// header is a comment with our version for -version-header, which
+// line protocol allows, unless the lines are going to InfluxDB
+// instead of into our output.
+func (influxFormat) header() string {
+	if !versionHeader || influxURL != "" {
+		return ""
+	}
+	return "# " + versionLine() + "\n"
+}
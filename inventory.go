@@ -0,0 +1,184 @@
+//
+// Reporting on what interfaces we have (-W). For each interface we
+// print its ifindex, operational state, MTU, MAC address, link speed
+// and flags, then its IPs (just IPv4 ones unless -6) and description,
+// so that '-W' is a quick audit of a machine's networking:
+//
+//	eth0       2  up      mtu 1500   52:54:00:12:34:56  1Gbit/s   <UP,BROADCAST,MULTICAST,RUNNING>  192.0.2.2
+//
+// With -v we also report whatever else sysfs tells us that's useful,
+// such as the interface's driver and what bond or bridge it's in, one
+// thing per line under it.
+//
+// We respect -l and -P because that seems at least vaguely useful, but
+// we don't respect -x. Things we don't know, such as the MAC address
+// of a loopback or anything about an SNMP host's interfaces besides
+// their names, are given as '-'.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+var verbose bool
+
+// ifaceInfo is what net.Interfaces() (and netlink) tell us about an
+// interface beyond its name and IPs.
+type ifaceInfo struct {
+	mac   string
+	mtu   int
+	flags net.Flags
+	state string
+}
+
+// fmtLinkSpeed formats a link speed in bits/sec.
+func fmtLinkSpeed(bits float64) string {
+	switch {
+	case bits == 0:
+		return "-"
+	case bits >= 1000*1000*1000:
+		return fmt.Sprintf("%gGbit/s", bits/(1000*1000*1000))
+	}
+	return fmt.Sprintf("%gMbit/s", bits/(1000*1000))
+}
+
+// fmtFlags formats interface flags the way ip(8) does.
+func fmtFlags(f net.Flags) string {
+	if f == 0 {
+		return "<>"
+	}
+	return "<" + strings.ToUpper(strings.ReplaceAll(f.String(), "|", ",")) + ">"
+}
+
+// orDash is s, or '-' if it's empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ifaceDetails is -v's extra information about an interface, as
+// label and value pairs. It comes from this machine's sysfs, so we
+// only have it for our own interfaces.
+func ifaceDetails(ni *netInfo, iname string) [][2]string {
+	var alts []string
+	for a, dev := range ni.altnames {
+		if dev == iname {
+			alts = append(alts, a)
+		}
+	}
+	sort.Strings(alts)
+
+	typ := devType(iname)
+	switch {
+	case typ != "":
+	case isVeth(iname):
+		typ = "veth"
+	case sysfsHas(iname, "device"):
+		typ = "physical"
+	}
+
+	// A device's bus address is where its 'device' points.
+	driver := sysfsLink(iname, "device/driver")
+	if bus := sysfsLink(iname, "device"); bus != "" && driver != "" {
+		driver += " (" + bus + ")"
+	}
+
+	var members string
+	if sl := slavesOf(iname); len(sl) > 0 {
+		members = strings.Join(sl, " ")
+	}
+
+	return [][2]string{
+		{"altnames", strings.Join(alts, " ")},
+		{"type", typ},
+		{"driver", driver},
+		{"master", sysfsLink(iname, "master")},
+		{"members", members},
+		{"duplex", sysfsNetAttr(iname, "duplex")},
+		{"permaddr", sysfsNetAttr(iname, "perm_addr")},
+		{"txqueuelen", sysfsNetAttr(iname, "tx_queue_len")},
+	}
+}
+
+// reportWhat reports on every interface.
+func reportWhat(c *config, ipv6too, noPtP bool) {
+	// We abuse an ipMap to collect each interface's IPs, because
+	// an ipMap is a generic string->[]string mapping.
+	ips := make(ipMap)
+	for ip, ifaces := range c.netinfo.ipmap {
+		if !ipv6too && strings.ContainsAny(ip, ":") {
+			continue
+		}
+		for _, iname := range ifaces {
+			ips.add(iname, ip)
+		}
+	}
+
+	// Some of our sources of interfaces only tell us about some
+	// of them in some places.
+	all := make(set[string])
+	all.addlist(c.netinfo.ifaces)
+	all.addlist(ips.members())
+	all.addlist(sortedKeys(c.netinfo.ifindex))
+	var inames []string
+	for _, iname := range all.members() {
+		if !c.incLo && c.netinfo.loopbacks.isin(iname) {
+			continue
+		}
+		if noPtP && c.netinfo.pointtopoint.isin(iname) {
+			continue
+		}
+		inames = append(inames, iname)
+	}
+	fitNames(inames...)
+
+	// Link speeds and -v's details come from sysfs, which is only
+	// right for our own interfaces.
+	local := ownStats() && netnsName == ""
+	for _, iname := range inames {
+		hw, ok := c.netinfo.hw[iname]
+		state, mtu, flags := "-", "-", "-"
+		if ok {
+			state = hw.state
+			if state == "" && hw.flags&net.FlagUp != 0 {
+				state = "up"
+			} else if state == "" {
+				state = "down"
+			}
+			mtu = fmt.Sprint(hw.mtu)
+			flags = fmtFlags(hw.flags)
+		}
+		speed := "-"
+		if local {
+			speed = fmtLinkSpeed(linkSpeed(iname) * 8)
+		}
+		l := fmt.Sprintf("%s %3d  %-7s mtu %-6s %-17s  %-9s %s", fmtName(iname), c.netinfo.ifindex[iname],
+			state, mtu, orDash(hw.mac), speed, flags)
+
+		addrs := ips[iname]
+		sort.Strings(addrs)
+		if len(addrs) > 0 {
+			l += "  " + strings.Join(addrs, " ")
+		}
+		if d, ok := c.netinfo.descs[iname]; ok {
+			l += "  (" + d + ")"
+		}
+		fmt.Println(l)
+
+		if !verbose || !local {
+			continue
+		}
+		for _, d := range ifaceDetails(c.netinfo, iname) {
+			if d[1] != "" {
+				fmt.Printf("    %s: %s\n", d[0], d[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//
+// JSON output (-j), for feeding netvolmon's reports to jq and other
+// programs. Each interval is written as a single line JSON object
+// with an entry for every device reported on. Rates are per second
+// and the interval is in seconds. The first line is instead an object
+// with our version and commit.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+var jsonOut bool
+
+type jsonDevice struct {
+	Device  string  `json:"device"`
+	Ifindex int     `json:"ifindex,omitempty"`
+	RxBps   float64 `json:"rx_bps"`
+	TxBps   float64 `json:"tx_bps"`
+	RxPps   float64 `json:"rx_pps"`
+	TxPps   float64 `json:"tx_pps"`
+	Burst   bool    `json:"burst,omitempty"`
+	Master  string  `json:"master,omitempty"`
+	// -D's description of the device.
+	Desc string `json:"desc,omitempty"`
+	// -avg's moving averages and -peaks' peaks, if we have them.
+	AvgRxBps  *float64 `json:"avg_rx_bps,omitempty"`
+	AvgTxBps  *float64 `json:"avg_tx_bps,omitempty"`
+	PeakRxBps *float64 `json:"peak_rx_bps,omitempty"`
+	PeakTxBps *float64 `json:"peak_tx_bps,omitempty"`
+	// -change's change in rates from the last interval.
+	RxChangeBps *float64 `json:"rx_change_bps,omitempty"`
+	TxChangeBps *float64 `json:"tx_change_bps,omitempty"`
+	// -cum's bytes so far.
+	RxBytesTotal *uint64 `json:"rx_bytes_total,omitempty"`
+	TxBytesTotal *uint64 `json:"tx_bytes_total,omitempty"`
+	// -util's percentages of link speed, if the device has one.
+	RxUtil *float64 `json:"rx_util_pct,omitempty"`
+	TxUtil *float64 `json:"tx_util_pct,omitempty"`
+}
+
+// jsonPreamble starts our output, with -version-header.
+type jsonPreamble struct {
+	Version string `json:"netvolmon_version"`
+	Commit  string `json:"commit"`
+}
+
+type jsonInterval struct {
+	Time     time.Time    `json:"time"`
+	Interval float64      `json:"interval"`
+	Quick    bool         `json:"quick,omitempty"`
+	Devices  []jsonDevice `json:"devices"`
+}
+
+// addJSON adds a device's interval to the JSON interval report.
+func (ji *jsonInterval) addJSON(devname string, dt DevDelta, ex lineExtras) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	ji.Time = dt.When
+	ji.Interval = persec
+	ji.Quick = ex.quick
+	jd := jsonDevice{
+		Device:  devname,
+		Ifindex: ex.ifindex,
+		RxBps:   float64(dt.RBytes) / persec,
+		TxBps:   float64(dt.TBytes) / persec,
+		RxPps:   float64(dt.RPackets) / persec,
+		TxPps:   float64(dt.TPackets) / persec,
+		Burst:   ex.burst,
+		Master:  ex.master,
+		Desc:    ex.desc,
+	}
+	if ex.avg {
+		jd.AvgRxBps, jd.AvgTxBps = &ex.avgRx, &ex.avgTx
+	}
+	if ex.peaks {
+		jd.PeakRxBps, jd.PeakTxBps = &ex.peakRx, &ex.peakTx
+	}
+	if ex.change {
+		jd.RxChangeBps, jd.TxChangeBps = &ex.rxChange, &ex.txChange
+	}
+	if ex.cum {
+		jd.RxBytesTotal, jd.TxBytesTotal = &ex.cumRx, &ex.cumTx
+	}
+	if ex.util {
+		jd.RxUtil, jd.TxUtil = &ex.rxUtil, &ex.txUtil
+	}
+	ji.Devices = append(ji.Devices, jd)
+}
+
+// writeJSON writes out the interval report, if there's anything in
+// it.
+func (ji *jsonInterval) writeJSON() error {
+	if len(ji.Devices) == 0 {
+		return nil
+	}
+	return json.NewEncoder(out).Encode(ji)
+}
+
+// jsonFormat is the formatter for JSON.
+type jsonFormat struct {
+	ji jsonInterval
+}
+
+func (jf *jsonFormat) begin(when time.Time) { jf.ji = jsonInterval{} }
+
+func (jf *jsonFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	jf.ji.addJSON(devname, dt, ex)
+}
+
+func (jf *jsonFormat) end() { jf.ji.writeJSON() }
+func (jf *jsonFormat) header() string {
+	if !versionHeader {
+		return ""
+	}
+	v, c := buildVersion()
+	b, _ := json.Marshal(jsonPreamble{Version: v, Commit: c})
+	return string(b) + "\n"
+}
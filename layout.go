@@ -0,0 +1,164 @@
+//
+// Report layouts (-layout). The normal line has a device's RX and TX
+// rates and packets/sec. The wide layout (-wide) adds its errors,
+// drops and received multicast packets in the interval, on systems
+// that tell us about them, and the narrow one (-narrow) cuts it down
+// to the device's total throughput, for small consoles.
+//
+// The default, auto, goes by the width of the terminal we're writing
+// to: narrow if a normal line won't fit, wide if a wide one easily
+// will, and normal otherwise (or if we're not writing to a terminal).
+// We get the width from $COLUMNS or stty(1).
+//
+// With -H N, we print a header naming the columns before the first
+// device line and again every N device lines, like vmstat(8), so that
+// you can still tell what's what after hours of scrolling.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var layoutName string
+var wideLayout, narrowLayout bool
+var headerEvery int
+
+// The terminal widths at which auto changes layout. A normal line is
+// about 70 columns, and a wide one about 120.
+const (
+	narrowBelow = 72
+	wideFrom    = 132
+)
+
+// setupLayout sorts out -layout, -wide and -narrow.
+func setupLayout() error {
+	switch {
+	case wideLayout && narrowLayout:
+		return fmt.Errorf("-wide and -narrow are mutually exclusive")
+	case wideLayout:
+		layoutName = "wide"
+	case narrowLayout:
+		layoutName = "narrow"
+	}
+	switch layoutName {
+	case "normal", "wide", "narrow":
+		return nil
+	case "auto":
+	default:
+		return fmt.Errorf("-layout must be auto, normal, wide or narrow")
+	}
+
+	layoutName = "normal"
+	fi, err := os.Stdout.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 || out != os.Stdout || formatName != "text" {
+		return nil
+	}
+	switch w := termWidth(); {
+	case w == 0:
+	case w < narrowBelow:
+		layoutName = "narrow"
+	case w >= wideFrom:
+		layoutName = "wide"
+	}
+	return nil
+}
+
+// termWidth is the width of our terminal, or 0 if we can't tell.
+func termWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	sz, err := stty("size")
+	if err != nil {
+		return 0
+	}
+	f := strings.Fields(sz)
+	if len(f) != 2 {
+		return 0
+	}
+	n, _ := strconv.Atoi(f[1])
+	return n
+}
+
+// printWide prints the wide layout's extra counters for an interval.
+func printWide(dt DevDelta) {
+	fmt.Fprintf(out, "   errs: %4d RX %4d TX   drops: %4d RX %4d TX   mcast: %5d",
+		dt.RErrors, dt.TErrors, dt.RDrops, dt.TDrops, dt.Multicast)
+}
+
+// printNarrow prints a device's line in the narrow layout.
+func printNarrow(c *config, devname string, dt DevDelta, ex lineExtras) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	rate := float64(dt.RBytes+dt.TBytes) / persec
+	bwD, bwU := c.getBwDiv(rate)
+	if c.perRateUnits {
+		bwD, bwU = c.getRateDiv(rate)
+	}
+	label := devname
+	if ex.master != "" {
+		label = "  " + devname
+	}
+	fitNames(label)
+	fmt.Fprintf(out, "%s ", fmtName(label))
+	if c.showTimestamp {
+		fmt.Fprintf(out, "%8s ", stamp(dt.When))
+	}
+	if showElapsed {
+		fmt.Fprintf(out, "%s ", elapsedStamp(dt.When))
+	}
+	fmt.Fprintf(out, "%s %s", heat(devname, rate, fmt.Sprintf("%7.2f", rate/bwD)), bwU)
+	if ex.quick {
+		fmt.Fprint(out, "  (quick)")
+	}
+	if ex.burst {
+		fmt.Fprint(out, "  BURST")
+	}
+	fmt.Fprintln(out)
+}
+
+// headerLine is the -H header for our current layout and options,
+// with each column name over its column.
+func headerLine(c *config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s ", fmtName("device"))
+	if c.showTimestamp {
+		fmt.Fprintf(&b, "%-*s ", len(stamp(time.Now())), "time")
+	}
+	if showElapsed {
+		fmt.Fprintf(&b, "%-*s ", len(elapsedStamp(runStart)), "elapsed")
+	}
+	if layoutName == "narrow" {
+		fmt.Fprintf(&b, "%7s", "total")
+		return b.String()
+	}
+
+	// Trend markers take up a column after RX and TX.
+	tpad := ""
+	if showTrend {
+		tpad = " "
+	}
+	if c.perRateUnits {
+		fmt.Fprintf(&b, "%6s %-6s   %s%6s %-6s   %s   ", "RX", "", tpad, "TX", "", tpad)
+	} else {
+		units := c.bwUnits
+		if units == "" {
+			_, units = c.getBwDiv(0)
+		}
+		fmt.Fprintf(&b, "%6s   %s %6s   %s %-*s   ", "RX", tpad, "TX", tpad, len(units)+2, "")
+	}
+	if c.scalePkts {
+		fmt.Fprintf(&b, "packets: %6s    %6s", "RX", "TX")
+	} else {
+		fmt.Fprintf(&b, "packets/sec: %5s    %5s", "RX", "TX")
+	}
+	if layoutName == "wide" {
+		fmt.Fprintf(&b, "   errs: %4s    %4s      drops: %4s    %4s      mcast:", "RX", "TX", "RX", "TX")
+	}
+	return strings.TrimRight(b.String(), " ")
+}
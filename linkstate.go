@@ -0,0 +1,70 @@
+//
+// Reporting link state changes (-linkstate). Each interval we check
+// the operstate of the devices we're watching, and print a notice
+// when one changes, so a link going down mid-run is reported rather
+// than its rates just going to zero or disappearing. We also notice
+// devices going away and coming back. This uses Linux's sysfs; other
+// systems never report changes.
+//
+// With JSON, CSV or line protocol output the notices go to standard
+// error instead, so they don't break it. Since we look at this
+// machine's sysfs, this can't be used with stats from elsewhere.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var showLinkState bool
+
+// linkStates are the last states we saw, by device.
+var linkStates = make(map[string]string)
+
+// operState returns a device's state, or "missing" if it doesn't
+// seem to exist.
+func operState(dev string) string {
+	if st := sysfsNetAttr(dev, "operstate"); st != "" {
+		return st
+	}
+	if sysfsHas(dev, "") {
+		return "unknown"
+	}
+	return "missing"
+}
+
+// checkLinks checks our devices, and everything we've seen before,
+// for state changes.
+func checkLinks(keys []string, when time.Time) {
+	devs := make(set[string])
+	devs.addlist(keys)
+	for dev := range linkStates {
+		devs.add(dev)
+	}
+	names := devs.members()
+
+	w := notesOut()
+	for _, dev := range names {
+		st := operState(dev)
+		old, seen := linkStates[dev]
+		linkStates[dev] = st
+		if !seen || old == st {
+			continue
+		}
+		var msg string
+		switch {
+		case st == "missing":
+			msg = "device went away"
+		case old == "missing":
+			msg = "device appeared, link " + st
+		default:
+			msg = fmt.Sprintf("link %s (was %s)", st, old)
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", stamp(when), dev, msg)
+		if desktopNotify {
+			notify(dev, "link "+st, fmt.Sprintf("netvolmon: %s %s", dev, msg), "at "+stamp(when))
+		}
+	}
+}
@@ -0,0 +1,232 @@
+//
+// Publishing to MQTT (-mqtt), for Home Assistant, Node-RED and other
+// home lab dashboards. Every interval we publish each device's rates
+// as JSON to its own topic, '<-mqtt-topic>/<device>':
+//
+//	{"time":"...","device":"eth0","rx_bps":1234.5,"tx_bps":678.9,"rx_pps":12,"tx_pps":8}
+//
+// The broker is given as host:port or as mqtt://[user:password@]host[:port]
+// (mqtts:// for TLS). We speak just enough MQTT 3.1.1 to publish at
+// QoS 0; we connect lazily and reconnect if publishing fails, so a
+// broker restart only costs us an interval or two.
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var mqttBroker string
+var mqttTopic string
+var mqttRetain bool
+
+type mqttSink struct {
+	addr       string
+	useTLS     bool
+	user, pass string
+	hasPass    bool
+	clientID   string
+	topic      string
+	conn       net.Conn
+	buf        bytes.Buffer
+}
+
+type mqttMessage struct {
+	Time time.Time `json:"time"`
+	jsonDevice
+}
+
+func newMQTTSink(broker, topic string) (*mqttSink, error) {
+	ms := &mqttSink{addr: broker}
+	if strings.Contains(broker, "://") {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return nil, err
+		}
+		port := "1883"
+		switch u.Scheme {
+		case "mqtt", "tcp":
+		case "mqtts", "ssl", "tls":
+			ms.useTLS = true
+			port = "8883"
+		default:
+			return nil, fmt.Errorf("'%s' is not an mqtt or mqtts URL", broker)
+		}
+		ms.addr = u.Host
+		if u.Port() == "" {
+			ms.addr = net.JoinHostPort(u.Hostname(), port)
+		}
+		if u.User != nil {
+			ms.user = u.User.Username()
+			ms.pass, ms.hasPass = u.User.Password()
+		}
+	}
+	if _, _, err := net.SplitHostPort(ms.addr); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	ms.clientID = fmt.Sprintf("netvolmon-%s-%d", host, os.Getpid())
+	if topic == "" {
+		topic = "netvolmon/" + host
+	}
+	ms.topic = strings.TrimSuffix(topic, "/")
+	return ms, nil
+}
+
+// mqttString is a string as MQTT encodes it, with a two byte length.
+func mqttString(b *bytes.Buffer, s string) {
+	b.WriteByte(byte(len(s) >> 8))
+	b.WriteByte(byte(len(s)))
+	b.WriteString(s)
+}
+
+// mqttPacket writes a packet with its fixed header to w.
+func mqttPacket(w *bytes.Buffer, kind byte, body []byte) {
+	w.WriteByte(kind)
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		w.WriteByte(d)
+		if n == 0 {
+			break
+		}
+	}
+	w.Write(body)
+}
+
+// connect connects to the broker, if we're not connected.
+func (ms *mqttSink) connect() error {
+	if ms.conn != nil {
+		return nil
+	}
+	d := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if ms.useTLS {
+		host, _, _ := net.SplitHostPort(ms.addr)
+		conn, err = tls.DialWithDialer(d, "tcp", ms.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", ms.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mqttString(&body, "MQTT")
+	body.WriteByte(4) // protocol level, ie 3.1.1
+	flags := byte(0x02)
+	if ms.user != "" {
+		flags |= 0x80
+		if ms.hasPass {
+			flags |= 0x40
+		}
+	}
+	body.WriteByte(flags)
+	// No keepalive; we publish regularly anyway.
+	body.Write([]byte{0, 0})
+	mqttString(&body, ms.clientID)
+	if ms.user != "" {
+		mqttString(&body, ms.user)
+		if ms.hasPass {
+			mqttString(&body, ms.pass)
+		}
+	}
+	var pkt bytes.Buffer
+	mqttPacket(&pkt, 0x10, body.Bytes())
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(pkt.Bytes()); err != nil {
+		conn.Close()
+		return err
+	}
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return err
+	}
+	if ack[0] != 0x20 || ack[1] != 2 {
+		conn.Close()
+		return errors.New("broker didn't answer with a CONNACK")
+	}
+	if ack[3] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused the connection (code %d)", ack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	ms.conn = conn
+	return nil
+}
+
+// add adds a device's interval to what we'll publish.
+func (ms *mqttSink) add(devname string, dt DevDelta, ifindex int) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	msg, err := json.Marshal(mqttMessage{dt.When, jsonDevice{
+		Device:  devname,
+		Ifindex: ifindex,
+		RxBps:   float64(dt.RBytes) / persec,
+		TxBps:   float64(dt.TBytes) / persec,
+		RxPps:   float64(dt.RPackets) / persec,
+		TxPps:   float64(dt.TPackets) / persec,
+	}})
+	if err != nil {
+		return
+	}
+	var body bytes.Buffer
+	mqttString(&body, ms.topic+"/"+devname)
+	body.Write(msg)
+	kind := byte(0x30)
+	if mqttRetain {
+		kind |= 0x01
+	}
+	mqttPacket(&ms.buf, kind, body.Bytes())
+}
+
+// flush publishes everything accumulated this interval. Failures are
+// logged but not fatal, and the messages are dropped.
+func (ms *mqttSink) flush() {
+	if ms.buf.Len() == 0 {
+		return
+	}
+	defer ms.buf.Reset()
+	if err := ms.connect(); err != nil {
+		log.Print("cannot connect to MQTT broker: ", err)
+		return
+	}
+	ms.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := ms.conn.Write(ms.buf.Bytes()); err != nil {
+		log.Print("publishing to MQTT failed: ", err)
+		ms.conn.Close()
+		ms.conn = nil
+	}
+}
+
+// close disconnects politely, if we're connected.
+func (ms *mqttSink) close() {
+	if ms.conn == nil {
+		return
+	}
+	ms.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	ms.conn.Write([]byte{0xe0, 0})
+	ms.conn.Close()
+	ms.conn = nil
+}
@@ -0,0 +1,63 @@
+//
+// The device name column. Normally it's as wide as the longest name
+// we've had to show (and at least 8), so that Linux names like
+// 'enp0s31f6' and long veth and bridge names don't push the rest of
+// their line out of step with everyone else's. It only ever grows, so
+// columns don't jump back and forth as devices come and go.
+//
+// With -name-width N it's always N wide instead, and longer names are
+// shortened to fit, the same way every time: ending in '…', or just
+// cut off with -name-trunc cut.
+//
+
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+var nameWidthFlag int
+var nameTrunc string
+
+// nameWidth is the current width of the name column.
+var nameWidth = 8
+
+// setupNameWidth checks -name-width and -name-trunc.
+func setupNameWidth() error {
+	if nameWidthFlag < 0 {
+		return fmt.Errorf("-name-width can't be negative")
+	}
+	if nameTrunc != "ellipsis" && nameTrunc != "cut" {
+		return fmt.Errorf("-name-trunc must be ellipsis or cut")
+	}
+	if nameWidthFlag > 0 {
+		nameWidth = nameWidthFlag
+	}
+	return nil
+}
+
+// fitNames widens the name column for names, unless it's fixed.
+func fitNames(names ...string) {
+	if nameWidthFlag > 0 {
+		return
+	}
+	for _, n := range names {
+		if l := utf8.RuneCountInString(n); l > nameWidth {
+			nameWidth = l
+		}
+	}
+}
+
+// fmtName formats a name for the name column.
+func fmtName(name string) string {
+	if utf8.RuneCountInString(name) > nameWidth {
+		r := []rune(name)
+		if nameTrunc == "cut" || nameWidth < 2 {
+			name = string(r[:nameWidth])
+		} else {
+			name = string(r[:nameWidth-1]) + "…"
+		}
+	}
+	return fmt.Sprintf("%-*s", nameWidth, name)
+}
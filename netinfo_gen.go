@@ -1,5 +1,6 @@
 //
-// Generic network interface information, using net.Interfaces() et al
+// Generic network interface information, using net.Interfaces() et al,
+// plus netlink on Linux.
 // Unfortunately the Go standard library only supports this on some
 // platforms.
 //
@@ -9,22 +10,47 @@ package main
 
 import (
 	"net"
+
+	"github.com/siebenmann/netvolmon/netvol"
 )
 
-func setupNetinfo() error {
+func setupNetinfo(ni *netInfo) error {
 	ints, e := net.Interfaces()
 	if e != nil {
 		return e
 	}
+	// Netlink is better than sysfs when we can use it, because
+	// sysfs doesn't follow us into another network namespace. Not
+	// having it is no reason to fail.
+	links, le := netvol.LinkInfos()
+	for dev, li := range links {
+		for _, n := range li.AltNames {
+			ni.altnames[n] = dev
+		}
+	}
 
 	for _, i := range ints {
 		if (i.Flags & net.FlagLoopback) > 0 {
-			netinfo.loopbacks.add(i.Name)
+			ni.loopbacks.add(i.Name)
 		}
 		if (i.Flags & net.FlagPointToPoint) > 0 {
-			netinfo.pointtopoint.add(i.Name)
+			ni.pointtopoint.add(i.Name)
+		}
+		ni.ifaces = append(ni.ifaces, i.Name)
+		ni.ifindex[i.Name] = i.Index
+		d, st := links[i.Name].Alias, links[i.Name].OperState
+		if le != nil {
+			d, st = sysfsNetAttr(i.Name, "ifalias"), sysfsNetAttr(i.Name, "operstate")
+		}
+		ni.hw[i.Name] = ifaceInfo{
+			mac:   i.HardwareAddr.String(),
+			mtu:   i.MTU,
+			flags: i.Flags,
+			state: st,
+		}
+		if d != "" {
+			ni.descs[i.Name] = d
 		}
-		netinfo.ifaces = append(netinfo.ifaces, i.Name)
 
 		addrs, e := i.Addrs()
 		if e != nil {
@@ -42,7 +68,7 @@ func setupNetinfo() error {
 			if e != nil {
 				continue
 			}
-			netinfo.ipmap.add(ip.String(), i.Name)
+			ni.ipmap.add(ip.String(), i.Name)
 		}
 	}
 	return nil
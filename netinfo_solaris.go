@@ -38,7 +38,7 @@ import (
 // net.Interfaces() stuff, so that when Go 1.x finally gets
 // support for it on Solaris we'll automatically start to
 // use it.
-func setupNetinfo() error {
+func setupNetinfo(ni *netInfo) error {
 	var ifap *C.struct_ifaddrs
 
 	rc, err := C.getifaddrs(&ifap)
@@ -46,7 +46,7 @@ func setupNetinfo() error {
 		C.freeifaddrs(ifap)
 		return err
 	}
-	ifaces := make(set)
+	ifaces := make(set[string])
 
 	// Note that the ifap list has one entry *per IP*; if a single
 	// interface has multiple IPs associated with it, via eg
@@ -59,12 +59,13 @@ func setupNetinfo() error {
 		}
 		iname := C.GoString(fi.ifa_name)
 		ifaces.add(iname)
+		ni.ifindex[iname] = int(C.if_nametoindex(fi.ifa_name))
 
 		if (fi.ifa_flags & C.IFF_LOOPBACK) > 0 {
-			netinfo.loopbacks.add(iname)
+			ni.loopbacks.add(iname)
 		}
 		if (fi.ifa_flags & C.IFF_POINTOPOINT) > 0 {
-			netinfo.pointtopoint.add(iname)
+			ni.pointtopoint.add(iname)
 		}
 
 		// Get the IPv4 address associated with this entry.
@@ -83,10 +84,10 @@ func setupNetinfo() error {
 		t := (*C.struct_sockaddr_in)(unsafe.Pointer(fi.ifa_addr)).sin_addr.S_un
 		ipstr := fmt.Sprintf("%d.%d.%d.%d", t[0], t[1], t[2], t[3])
 
-		netinfo.ipmap.add(ipstr, iname)
+		ni.ipmap.add(ipstr, iname)
 	}
 	C.freeifaddrs(ifap)
 
-	netinfo.ifaces = ifaces.members()
+	ni.ifaces = ifaces.members()
 	return nil
 }
@@ -1,8 +1,29 @@
 // Provide a mapping from customary local network names to CIDR netblocks
 // for them.
+//
+// The built in names are CSLab's. Other people can put their own in a
+// file (by default ~/.config/netvolmon/networks, or -netnames), which
+// replaces them entirely. The file has one name per line:
+//
+//	# comments and blank lines are ignored
+//	office   10.1.2.0/24
+//	lab      10.1.3.0/24
+//	work     office lab
+//
+// A name with a CIDR is a network name; a name with one or more other
+// names is a multi-name that matches any of them.
 
 package main
 
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 // name to CIDR
 var cslabNetNames = map[string]string{
 	"net3": "128.100.3.0/24",
@@ -25,3 +46,115 @@ var cslabMultiNames = map[string][]string{
 	"iscsi": {"iscsi1", "iscsi2"},
 	"blue":  {"net3", "net5"},
 }
+
+// netNamesFrom is where each of our names was defined, as
+// 'file:line', if it came from a file.
+var netNamesFrom = make(map[string]string)
+
+// nameErr is an error about a name, saying where it's from if we
+// know.
+func nameErr(name, format string, a ...interface{}) error {
+	err := fmt.Errorf(format, a...)
+	if w, ok := netNamesFrom[name]; ok {
+		return fmt.Errorf("%s: %w", w, err)
+	}
+	return err
+}
+
+// checkNetNames validates our network name tables, returning a list
+// of everything that's wrong with them. Every CIDR must parse, and
+// every multi-name must refer only to names that actually exist.
+func checkNetNames() []error {
+	var errs []error
+
+	names := sortedKeys(cslabNetNames)
+	for _, k := range names {
+		if _, _, err := net.ParseCIDR(cslabNetNames[k]); err != nil {
+			errs = append(errs, nameErr(k, "network name '%s': bad CIDR '%s'", k, cslabNetNames[k]))
+		}
+	}
+
+	names = sortedKeys(cslabMultiNames)
+	for _, k := range names {
+		if _, ok := cslabNetNames[k]; ok {
+			errs = append(errs, nameErr(k, "multi-name '%s' is also a network name", k))
+		}
+		if len(cslabMultiNames[k]) == 0 {
+			errs = append(errs, nameErr(k, "multi-name '%s' has no members", k))
+		}
+		for _, n := range cslabMultiNames[k] {
+			if _, ok := cslabNetNames[n]; !ok {
+				errs = append(errs, nameErr(k, "multi-name '%s' refers to unknown network name '%s'", k, n))
+			}
+		}
+	}
+	return errs
+}
+
+// netNamesFile is the file of network names to load, if any.
+var netNamesFile string
+
+// defaultNetNamesFile returns where we look for network names if we
+// aren't told, or "" if there's nowhere.
+func defaultNetNamesFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "netvolmon", "networks")
+}
+
+// loadNetNames replaces our network names with ones from a file. If
+// the file was only our default and doesn't exist, we quietly keep
+// the built in names. Bad CIDRs and dangling multi-names are left for
+// checkNetNames to find, with the file and line they're on.
+func loadNetNames(fname string, explicit bool) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	multis := make(map[string][]string)
+	from := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	lnum := 0
+	for sc.Scan() {
+		lnum++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("%s:%d: name '%s' has nothing for it to be", fname, lnum, fields[0])
+		}
+		k := fields[0]
+		if _, ok := names[k]; ok {
+			return fmt.Errorf("%s:%d: name '%s' is repeated", fname, lnum, k)
+		}
+		if _, ok := multis[k]; ok {
+			return fmt.Errorf("%s:%d: name '%s' is repeated", fname, lnum, k)
+		}
+		from[k] = fmt.Sprintf("%s:%d", fname, lnum)
+		if len(fields) == 2 && strings.Contains(fields[1], "/") {
+			names[k] = fields[1]
+		} else {
+			multis[k] = fields[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	cslabNetNames = names
+	cslabMultiNames = multis
+	netNamesFrom = from
+	return nil
+}
@@ -0,0 +1,68 @@
+//
+// Entering another network namespace (-netns) on Linux, so that we
+// can watch a container's or a router namespace's devices from the
+// host. Namespaces are per-thread, so we keep the main goroutine on
+// the main thread and switch that; everything that gathers stats runs
+// there. /proc/net follows the main thread, as do netlink sockets.
+//
+// Sysfs doesn't follow us; /sys/class/net still shows the namespace
+// it was mounted in. So in another namespace we skip the sysfs fast
+// path for stats, and things like interface descriptions, '@type'
+// specifiers and -slaves may not find anything.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setnsCalls are setns()'s system call numbers. The syscall package
+// only has them for some architectures, amd64 not among them.
+var setnsCalls = map[string]uintptr{
+	"386": 346, "amd64": 308, "arm": 375, "arm64": 268,
+	"loong64": 268, "riscv64": 268, "ppc64": 350, "ppc64le": 350,
+	"s390x": 339, "mips": 4344, "mipsle": 4344,
+	"mips64": 5303, "mips64le": 5303,
+}
+
+func init() {
+	runtime.LockOSThread()
+}
+
+// netnsPath turns a -netns argument into the namespace file to open.
+// A number is a process ID, a path is itself, and anything else is a
+// name from 'ip netns'.
+func netnsPath(ns string) string {
+	if _, err := strconv.Atoi(ns); err == nil {
+		return filepath.Join("/proc", ns, "ns", "net")
+	}
+	if strings.ContainsRune(ns, '/') {
+		return ns
+	}
+	return filepath.Join("/run/netns", ns)
+}
+
+// enterNetns switches the main thread into a network namespace.
+func enterNetns(ns string) error {
+	setns, ok := setnsCalls[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("don't know how to setns on %s", runtime.GOARCH)
+	}
+	f, err := os.Open(netnsPath(ns))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, errno := syscall.Syscall(setns, f.Fd(), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return fmt.Errorf("setns %s: %s", ns, errno)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//
+// Only Linux has network namespaces.
+//
+
+//go:build !linux
+// +build !linux
+
+package main
+
+func enterNetns(ns string) error {
+	return unsupported("network namespaces are only supported on Linux")
+}
@@ -0,0 +1,75 @@
+//
+// OpenBSD and NetBSD implementation of obtaining a point in time
+// snapshot of network device activity. We get everything from the
+// routing sysctl's interface list (NET_RT_IFLIST), which gives us an
+// if_data structure per interface with 64-bit counters on both.
+//
+
+//go:build openbsd || netbsd
+// +build openbsd netbsd
+
+package netvol
+
+import (
+	"syscall"
+	"time"
+)
+
+// ifName extracts the interface name from an interface routing
+// message, or returns "" if there isn't one.
+func ifName(m *syscall.InterfaceMessage) string {
+	sas, err := syscall.ParseRoutingSockaddr(m)
+	if err != nil || len(sas) <= syscall.RTAX_IFP {
+		return ""
+	}
+	sdl, ok := sas[syscall.RTAX_IFP].(*syscall.SockaddrDatalink)
+	if !ok {
+		return ""
+	}
+	name := make([]byte, 0, sdl.Nlen)
+	for i := 0; i < int(sdl.Nlen) && i < len(sdl.Data); i++ {
+		name = append(name, byte(sdl.Data[i]))
+	}
+	return string(name)
+}
+
+// Fill fills a Stats map with current network stats for all known
+// network devices.
+func (s Stats) Fill() error {
+	// One sysctl gets us everything at once, so all of the
+	// measurements are in sync.
+	when := time.Now()
+	rib, err := syscall.RouteRIB(syscall.NET_RT_IFLIST, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range msgs {
+		im, ok := m.(*syscall.InterfaceMessage)
+		if !ok {
+			// address messages and so on
+			continue
+		}
+		name := ifName(im)
+		if name == "" {
+			continue
+		}
+		d := &im.Header.Data
+		s[name] = DevStat{
+			When:      when,
+			RBytes:    d.Ibytes,
+			TBytes:    d.Obytes,
+			RPackets:  d.Ipackets,
+			TPackets:  d.Opackets,
+			RErrors:   d.Ierrors,
+			TErrors:   d.Oerrors,
+			RDrops:    d.Iqdrops,
+			Multicast: d.Imcasts,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+//
+// macOS (Darwin) implementation of obtaining a point in time snapshot
+// of network device activity. We use the NET_RT_IFLIST2 routing
+// sysctl, which gives us an if_msghdr2 per interface with a 64-bit
+// if_data64 in it. The ordinary if_data counters are only 32 bits and
+// wrap far too fast on modern networks.
+//
+// Go's syscall package doesn't know about RTM_IFINFO2 messages, so we
+// pick the fields we want out of the raw bytes ourselves.
+//
+
+package netvol
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Offsets into a struct if_msghdr2, from <net/if.h>. The if_data64
+// starts at ifm2Data.
+const (
+	ifm2Msglen = 0
+	ifm2Type   = 3
+	ifm2Index  = 12
+	ifm2Data   = 32
+
+	ifd64Ipackets = ifm2Data + 24
+	ifd64Ierrors  = ifm2Data + 32
+	ifd64Opackets = ifm2Data + 40
+	ifd64Oerrors  = ifm2Data + 48
+	ifd64Ibytes   = ifm2Data + 64
+	ifd64Obytes   = ifm2Data + 72
+	ifd64Imcasts  = ifm2Data + 80
+	ifd64Iqdrops  = ifm2Data + 96
+
+	// We need at least this much of the message.
+	ifm2MinLen = ifd64Iqdrops + 8
+)
+
+// Fill fills a Stats map with current network stats for all known
+// network devices.
+func (s Stats) Fill() error {
+	// if_msghdr2 only has an interface index, so we need to be
+	// able to map those to names.
+	ints, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	names := make(map[uint16]string)
+	for _, i := range ints {
+		names[uint16(i.Index)] = i.Name
+	}
+
+	when := time.Now()
+	rib, err := syscall.RouteRIB(syscall.NET_RT_IFLIST2, 0)
+	if err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	for len(rib) >= 4 {
+		mlen := int(le.Uint16(rib[ifm2Msglen:]))
+		if mlen == 0 || mlen > len(rib) {
+			return errors.New("malformed NET_RT_IFLIST2 data")
+		}
+		m := rib[:mlen]
+		rib = rib[mlen:]
+
+		if m[ifm2Type] != syscall.RTM_IFINFO2 || mlen < ifm2MinLen {
+			continue
+		}
+		name, ok := names[le.Uint16(m[ifm2Index:])]
+		if !ok {
+			continue
+		}
+		s[name] = DevStat{
+			When:      when,
+			RBytes:    le.Uint64(m[ifd64Ibytes:]),
+			TBytes:    le.Uint64(m[ifd64Obytes:]),
+			RPackets:  le.Uint64(m[ifd64Ipackets:]),
+			TPackets:  le.Uint64(m[ifd64Opackets:]),
+			RErrors:   le.Uint64(m[ifd64Ierrors:]),
+			TErrors:   le.Uint64(m[ifd64Oerrors:]),
+			RDrops:    le.Uint64(m[ifd64Iqdrops:]),
+			Multicast: le.Uint64(m[ifd64Imcasts:]),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+//
+// Linux implementation of obtaining a point in time snapshot of network
+// device activity. We normally get it through netlink (see
+// netlink_linux.go), but if that doesn't work we read /proc/net/dev.
+// If we're only asked for a few specific devices (FillDevices), we read
+// just their counters from sysfs instead, which is much cheaper on
+// hosts with thousands of devices.
+
+package netvol
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// useNetlink is cleared the first time netlink fails us, after which
+// we stick with /proc/net/dev.
+var useNetlink = true
+
+// Fill fills a Stats map with current network stats for all known
+// network devices.
+func (s Stats) Fill() error {
+	if useNetlink {
+		err := s.fillNetlink()
+		if err == nil {
+			return nil
+		}
+		useNetlink = false
+		for k := range s {
+			delete(s, k)
+		}
+	}
+	return s.fillProc()
+}
+
+// sysfsCounter reads one of a device's statistics counters.
+func sysfsCounter(dev, name string, e error) (uint64, error) {
+	b, err := ioutil.ReadFile(filepath.Join("/sys/class/net", dev, "statistics", name))
+	if err != nil {
+		return 0, err
+	}
+	return getInt(strings.TrimSpace(string(b)), e)
+}
+
+// fillDevices fills a Stats map with just the given devices, from
+// their /sys/class/net/<dev>/statistics files. Devices that have gone
+// away are left out. It returns false if it got nothing at all, in
+// which case our caller should do a full Fill.
+func (s Stats) fillDevices(devs []string) bool {
+	for _, dev := range devs {
+		var st DevStat
+		var err error
+		st.When = time.Now()
+		st.RBytes, err = sysfsCounter(dev, "rx_bytes", err)
+		st.TBytes, err = sysfsCounter(dev, "tx_bytes", err)
+		st.RPackets, err = sysfsCounter(dev, "rx_packets", err)
+		st.TPackets, err = sysfsCounter(dev, "tx_packets", err)
+		st.RErrors, err = sysfsCounter(dev, "rx_errors", err)
+		st.TErrors, err = sysfsCounter(dev, "tx_errors", err)
+		st.RDrops, err = sysfsCounter(dev, "rx_dropped", err)
+		st.TDrops, err = sysfsCounter(dev, "tx_dropped", err)
+		st.Multicast, err = sysfsCounter(dev, "multicast", err)
+		if err == nil {
+			s[dev] = st
+		}
+	}
+	return len(s) > 0
+}
+
+// fillProc fills a Stats map from /proc/net/dev.
+func (s Stats) fillProc() error {
+	// We read all of /proc/net/dev however big it is (hosts with
+	// thousands of container veths make it very big), but stamp it
+	// once, before we start, so that all of its devices are in sync.
+	when := time.Now()
+	data, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("read 0 bytes from /proc/net/dev")
+	}
+	return s.ParseProcNetDev(data, when)
+}
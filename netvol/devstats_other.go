@@ -0,0 +1,13 @@
+//
+// Everywhere else, we can't get stats at all.
+//
+
+//go:build !linux && !solaris && !openbsd && !netbsd && !darwin && !windows
+// +build !linux,!solaris,!openbsd,!netbsd,!darwin,!windows
+
+package netvol
+
+// Fill always fails with ErrUnsupported.
+func (s Stats) Fill() error {
+	return ErrUnsupported
+}
@@ -4,19 +4,30 @@
 // Solaris kstats, which we read via my package for doing this.
 //
 
-package main
+package netvol
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/siebenmann/go-kstat"
 )
 
-// We hold our kstat perpetually open.
-// In theory this leaks memory, but.
+// We hold our kstat open until Close.
 var khandle *kstat.Token
 
+// Close releases what we hold open to get stats. Getting stats again
+// afterward opens it all up again.
+func Close() error {
+	if khandle == nil {
+		return nil
+	}
+	err := khandle.Close()
+	khandle = nil
+	return err
+}
+
 // getUint gets a Uint64 named kstat if there have been no errors to
 // date, and otherwise rolls errors forward (returning 0 as the
 // kstat's value).
@@ -71,8 +82,12 @@ func (s Stats) Fill() error {
 		}
 	}
 
-	//
-	for _, iname := range netinfo.ifaces {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, i := range ifaces {
+		iname := i.Name
 		devst, err := statsFor(iname)
 		if err != nil {
 			return err
@@ -0,0 +1,117 @@
+//
+// Windows implementation of obtaining a point in time snapshot of
+// network device activity, through the IP Helper API's GetIfTable2(),
+// which gives us 64-bit counters for every interface.
+//
+// Interface information (names, addresses, loopback and so on) comes
+// from the generic net.Interfaces() code, which works on Windows.
+// Windows interfaces are named by their alias (eg 'Ethernet' or
+// 'Wi-Fi'), which is also what net.Interfaces() uses.
+//
+
+package netvol
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	iphlpapi         = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetIfTable2  = iphlpapi.NewProc("GetIfTable2")
+	procFreeMibTable = iphlpapi.NewProc("FreeMibTable")
+)
+
+// mibIfRow2 is MIB_IF_ROW2 from <netioapi.h>.
+type mibIfRow2 struct {
+	InterfaceLuid               uint64
+	InterfaceIndex              uint32
+	InterfaceGUID               [16]byte
+	Alias                       [257]uint16
+	Description                 [257]uint16
+	PhysicalAddressLength       uint32
+	PhysicalAddress             [32]byte
+	PermanentPhysicalAddress    [32]byte
+	Mtu                         uint32
+	Type                        uint32
+	TunnelType                  uint32
+	MediaType                   uint32
+	PhysicalMediumType          uint32
+	AccessType                  uint32
+	DirectionType               uint32
+	InterfaceAndOperStatusFlags uint8
+	OperStatus                  uint32
+	AdminStatus                 uint32
+	MediaConnectState           uint32
+	NetworkGUID                 [16]byte
+	ConnectionType              uint32
+	_                           uint32 // C alignment, even on 386
+	TransmitLinkSpeed           uint64
+	ReceiveLinkSpeed            uint64
+	InOctets                    uint64
+	InUcastPkts                 uint64
+	InNUcastPkts                uint64
+	InDiscards                  uint64
+	InErrors                    uint64
+	InUnknownProtos             uint64
+	InUcastOctets               uint64
+	InMulticastOctets           uint64
+	InBroadcastOctets           uint64
+	OutOctets                   uint64
+	OutUcastPkts                uint64
+	OutNUcastPkts               uint64
+	OutDiscards                 uint64
+	OutErrors                   uint64
+	OutUcastOctets              uint64
+	OutMulticastOctets          uint64
+	OutBroadcastOctets          uint64
+	OutQLen                     uint64
+}
+
+// mibIfTable2 is the header of MIB_IF_TABLE2; the rows follow it.
+type mibIfTable2 struct {
+	NumEntries uint32
+	_          uint32
+	// Table [NumEntries]mibIfRow2
+}
+
+// Set in InterfaceAndOperStatusFlags for NDIS filter interfaces,
+// which duplicate the counters of the real interface under them.
+const filterInterface = 0x02
+
+// Fill fills a Stats map with current network stats for all known
+// network devices.
+func (s Stats) Fill() error {
+	var table *mibIfTable2
+	when := time.Now()
+	r, _, _ := procGetIfTable2.Call(uintptr(unsafe.Pointer(&table)))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	defer procFreeMibTable.Call(uintptr(unsafe.Pointer(table)))
+
+	for i := uint32(0); i < table.NumEntries; i++ {
+		row := (*mibIfRow2)(unsafe.Pointer(uintptr(unsafe.Pointer(table)) +
+			unsafe.Sizeof(*table) + uintptr(i)*unsafe.Sizeof(mibIfRow2{})))
+		if row.InterfaceAndOperStatusFlags&filterInterface != 0 {
+			continue
+		}
+		name := syscall.UTF16ToString(row.Alias[:])
+		if name == "" {
+			continue
+		}
+		s[name] = DevStat{
+			When:     when,
+			RBytes:   row.InOctets,
+			TBytes:   row.OutOctets,
+			RPackets: row.InUcastPkts + row.InNUcastPkts,
+			TPackets: row.OutUcastPkts + row.OutNUcastPkts,
+			RErrors:  row.InErrors,
+			TErrors:  row.OutErrors,
+			RDrops:   row.InDiscards,
+			TDrops:   row.OutDiscards,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//
+// Systems other than Linux don't have a cheaper way of getting stats
+// for only some devices, so FillDevices always does a full Fill.
+//
+
+//go:build !linux
+// +build !linux
+
+package netvol
+
+func (s Stats) fillDevices(devs []string) bool {
+	return false
+}
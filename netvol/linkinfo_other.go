@@ -0,0 +1,14 @@
+//
+// Only Linux has netlink to tell us more about devices.
+//
+
+//go:build !linux
+// +build !linux
+
+package netvol
+
+// LinkInfos returns what netlink can tell us about every device
+// besides its stats, which here is nothing.
+func LinkInfos() (map[string]LinkInfo, error) {
+	return nil, ErrUnsupported
+}
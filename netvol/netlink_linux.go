@@ -0,0 +1,184 @@
+//
+// Getting Linux network device stats through netlink. An RTM_GETLINK
+// dump gives us every device's rtnl_link_stats64 in one structured
+// reply, so we skip formatting and parsing /proc/net/dev and its size
+// limit. If netlink doesn't work for some reason, Fill falls back to
+// /proc/net/dev.
+//
+
+package netvol
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// IFLA_STATS64 is too new for the syscall package.
+const iflaStats64 = 23
+
+// rtnl_link_stats64 starts with rx_packets, tx_packets, rx_bytes,
+// tx_bytes, rx_errors, tx_errors, rx_dropped, tx_dropped and
+// multicast, which is all we want from it.
+const linkStats64Len = 9 * 8
+
+// rtnl_link_stats64 is in host byte order.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// linkDump returns the attributes of every device in an RTM_GETLINK
+// dump.
+func linkDump() ([][]syscall.NetlinkRouteAttr, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+	var links [][]syscall.NetlinkRouteAttr
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type != syscall.RTM_NEWLINK {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, attrs)
+	}
+	return links, nil
+}
+
+// attrString is a string attribute, which is NUL-terminated.
+func attrString(v []byte) string {
+	if n := len(v); n > 0 && v[n-1] == 0 {
+		v = v[:n-1]
+	}
+	return string(v)
+}
+
+// fillNetlink fills a Stats map from an RTM_GETLINK dump.
+func (s Stats) fillNetlink() error {
+	when := time.Now()
+	links, err := linkDump()
+	if err != nil {
+		return err
+	}
+
+	for _, attrs := range links {
+		var name string
+		var stats []byte
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.IFLA_IFNAME:
+				name = attrString(a.Value)
+			case iflaStats64:
+				stats = a.Value
+			}
+		}
+		if name == "" {
+			continue
+		}
+		// Kernels old enough not to have 64-bit stats get
+		// /proc/net/dev instead.
+		if len(stats) < linkStats64Len {
+			return errors.New("no 64-bit link stats for " + name)
+		}
+		s[name] = DevStat{
+			When:      when,
+			RPackets:  nativeEndian.Uint64(stats[0:]),
+			TPackets:  nativeEndian.Uint64(stats[8:]),
+			RBytes:    nativeEndian.Uint64(stats[16:]),
+			TBytes:    nativeEndian.Uint64(stats[24:]),
+			RErrors:   nativeEndian.Uint64(stats[32:]),
+			TErrors:   nativeEndian.Uint64(stats[40:]),
+			RDrops:    nativeEndian.Uint64(stats[48:]),
+			TDrops:    nativeEndian.Uint64(stats[56:]),
+			Multicast: nativeEndian.Uint64(stats[64:]),
+		}
+	}
+	if len(s) == 0 {
+		return errors.New("netlink reported no devices")
+	}
+	return nil
+}
+
+// Alternate names (as from 'ip link property add dev X altname Y')
+// come in an IFLA_PROP_LIST of IFLA_ALT_IFNAME attributes. Neither is
+// in the syscall package. Nested attributes have a flag bit set in
+// their type.
+const (
+	iflaPropList  = 52
+	iflaAltIfname = 53
+	nlaTypeMask   = 0x3fff
+	rtaHeaderLen  = 4
+	rtaAlignTo    = 4
+)
+
+// operStates are the names of IFLA_OPERSTATE's values (RFC 2863's),
+// as sysfs gives them.
+var operStates = []string{"unknown", "notpresent", "down", "lowerlayerdown", "testing", "dormant", "up"}
+
+// LinkInfos returns what netlink can tell us about every device
+// besides its stats. Kernels before 5.5 have no altnames.
+func LinkInfos() (map[string]LinkInfo, error) {
+	links, err := linkDump()
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]LinkInfo)
+	for _, attrs := range links {
+		var name string
+		var li LinkInfo
+		for _, a := range attrs {
+			switch a.Attr.Type & nlaTypeMask {
+			case syscall.IFLA_IFNAME:
+				name = attrString(a.Value)
+			case syscall.IFLA_IFALIAS:
+				li.Alias = attrString(a.Value)
+			case syscall.IFLA_OPERSTATE:
+				if len(a.Value) > 0 && int(a.Value[0]) < len(operStates) {
+					li.OperState = operStates[a.Value[0]]
+				}
+			case iflaPropList:
+				li.AltNames = altIfnames(a.Value)
+			}
+		}
+		if name != "" {
+			infos[name] = li
+		}
+	}
+	return infos, nil
+}
+
+// altIfnames pulls the IFLA_ALT_IFNAMEs out of an IFLA_PROP_LIST.
+func altIfnames(b []byte) []string {
+	var names []string
+	for len(b) >= rtaHeaderLen {
+		l := int(nativeEndian.Uint16(b[0:]))
+		typ := nativeEndian.Uint16(b[2:])
+		if l < rtaHeaderLen || l > len(b) {
+			break
+		}
+		if typ&nlaTypeMask == iflaAltIfname {
+			names = append(names, attrString(b[rtaHeaderLen:l]))
+		}
+		l = (l + rtaAlignTo - 1) &^ (rtaAlignTo - 1)
+		if l > len(b) {
+			break
+		}
+		b = b[l:]
+	}
+	return names
+}
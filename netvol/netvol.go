@@ -0,0 +1,200 @@
+//
+// Package netvol gets point in time snapshots of network device
+// statistics (bytes and packets received and transmitted) on a number
+// of systems, and works out the deltas between them. It's the guts of
+// netvolmon, split out so that other programs can use it.
+//
+// Usage is simple:
+//
+//	old := make(netvol.Stats)
+//	err := old.Fill()
+//	... wait a while ...
+//	cur := make(netvol.Stats)
+//	err = cur.Fill()
+//	deltas := netvol.GenDeltas(old, cur)
+//
+
+package netvol
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrUnsupported is what Fill returns on systems we don't know how to
+// get stats on.
+var ErrUnsupported = errors.New("getting network device stats isn't supported on this system")
+
+// A DevStat represents a moment in time snapshot of a network device's
+// current statistics.
+type DevStat struct {
+	When     time.Time
+	RBytes   uint64
+	TBytes   uint64
+	RPackets uint64
+	TPackets uint64
+	// Errors, drops and received multicast packets, on systems
+	// that tell us. Elsewhere they're always zero.
+	RErrors   uint64
+	TErrors   uint64
+	RDrops    uint64
+	TDrops    uint64
+	Multicast uint64
+}
+
+// A LinkInfo is what we can find out about a device on Linux besides
+// its stats.
+type LinkInfo struct {
+	// Alternate names, as from 'ip link property add dev X altname Y'.
+	AltNames []string
+	// The device's description (ifalias), if it has one.
+	Alias string
+	// Its operational state, as in /sys/class/net/<dev>/operstate.
+	OperState string
+}
+
+// A DevDelta represents the difference between two DevStats. It has
+// the same fields, plus a Delta that is the time difference between
+// them.
+type DevDelta struct {
+	DevStat
+	Delta time.Duration
+}
+
+// Some drivers and most SNMP agents only have 32-bit counters, which
+// wrap around every 4 GB at 10G speeds. If an old counter fits in 32
+// bits and the new one is smaller, we take it to have wrapped, as
+// long as that gives us at most half of the counter's range; more
+// than that is too likely to be something else, such as the counter
+// being reset.
+const wrap32 = 1 << 32
+
+// subChecked subtracts two numbers, allowing for a 32-bit counter
+// wrapping around in between. It preserves a running flag of good
+// vs bad if its particular check is good, otherwise returns 0
+// and false.
+func subChecked(a, b uint64, good bool) (uint64, bool) {
+	if a <= b {
+		return b - a, good
+	}
+	if a < wrap32 && b+wrap32-a <= wrap32/2 {
+		return b + wrap32 - a, good
+	}
+	return 0, false
+}
+
+// Delta computes the change between two DevStats and returns a delta
+// along with an indicator if it's good. Deltas are bad if a counter
+// went backwards in a way that a 32-bit rollover doesn't explain.
+func Delta(oldst, newst *DevStat) (DevDelta, bool) {
+	good := true
+
+	n := DevDelta{}
+	n.Delta = newst.When.Sub(oldst.When)
+	n.When = newst.When
+	n.RBytes, good = subChecked(oldst.RBytes, newst.RBytes, good)
+	n.TBytes, good = subChecked(oldst.TBytes, newst.TBytes, good)
+	n.RPackets, good = subChecked(oldst.RPackets, newst.RPackets, good)
+	n.TPackets, good = subChecked(oldst.TPackets, newst.TPackets, good)
+	n.RErrors, good = subChecked(oldst.RErrors, newst.RErrors, good)
+	n.TErrors, good = subChecked(oldst.TErrors, newst.TErrors, good)
+	n.RDrops, good = subChecked(oldst.RDrops, newst.RDrops, good)
+	n.TDrops, good = subChecked(oldst.TDrops, newst.TDrops, good)
+	n.Multicast, good = subChecked(oldst.Multicast, newst.Multicast, good)
+	return n, good
+}
+
+// Stats represents a collection of device stats, one entry per device.
+//
+// Concrete system-dependent support for this creates a .Fill() method
+// that fills a Stats map with a point in time snapshot of available
+// network device stats. So far Linux, Solaris, OpenBSD, NetBSD, macOS
+// and Windows are supported; elsewhere Fill returns ErrUnsupported.
+type Stats map[string]DevStat
+
+// FillDevices is like Fill, except that the caller only cares about
+// the given devices. Some systems can get stats for just them more
+// cheaply than for everything, but others will fill in everything
+// anyway. With no devices it's the same as Fill.
+func (s Stats) FillDevices(devs []string) error {
+	if len(devs) > 0 && s.fillDevices(devs) {
+		return nil
+	}
+	return s.Fill()
+}
+
+// Deltas represents the delta between two device stats, one entry per device
+type Deltas map[string]DevDelta
+
+// Members returns the names of all devices in a Stats, sorted.
+func (s Stats) Members() []string {
+	return sortedKeys(s)
+}
+
+// Members returns the names of all devices in a Deltas, sorted.
+func (d Deltas) Members() []string {
+	return sortedKeys(d)
+}
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// GenDeltas generates a set of deltas between two Stats. Devices can appear and
+// disappear; only devices that are in both Stats are included in the
+// deltas. We skip any devices that appear to have had their counters
+// reset (see Resets) and any devices that appear to be totally
+// inactive, with no bytes ever transmitted or received.
+func GenDeltas(oldinfo, newinfo Stats) Deltas {
+	d := make(Deltas)
+	for devname, nv := range newinfo {
+		// Skip interfaces that seem to be totally inactive.
+		// Our standard for 'totally inactive' is no bytes
+		// received, because systems can try to send stuff
+		// out on dead interfaces for reasons.
+		//
+		// It isn't sufficient to check the interface's
+		// FlagUp, because we can have up but totally
+		// inactive interfaces.
+		if nv.RBytes == 0 {
+			continue
+		}
+		ov, ok := oldinfo[devname]
+		if !ok {
+			continue
+		}
+		delta, good := Delta(&ov, &nv)
+		if good {
+			d[devname] = delta
+		}
+	}
+	return d
+}
+
+// Resets returns the devices whose counters went backwards between two
+// Stats, in a way that a rollover doesn't explain. Usually this means
+// that the device was destroyed and recreated under the same name, or
+// its driver was reloaded. GenDeltas leaves these devices out.
+func Resets(oldinfo, newinfo Stats) []string {
+	var r []string
+	for devname, nv := range newinfo {
+		ov, ok := oldinfo[devname]
+		if !ok {
+			continue
+		}
+		if _, good := Delta(&ov, &nv); !good {
+			r = append(r, devname)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,94 @@
+package netvol
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelta(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	t1 := t0.Add(2 * time.Second)
+	tests := []struct {
+		name     string
+		old, new DevStat
+		want     DevDelta
+		good     bool
+	}{
+		{"normal",
+			DevStat{When: t0, RBytes: 1000, TBytes: 500, RPackets: 10, TPackets: 5},
+			DevStat{When: t1, RBytes: 3000, TBytes: 700, RPackets: 30, TPackets: 7},
+			DevDelta{DevStat{When: t1, RBytes: 2000, TBytes: 200, RPackets: 20, TPackets: 2}, 2 * time.Second},
+			true},
+		{"no change",
+			DevStat{When: t0, RBytes: 1000},
+			DevStat{When: t1, RBytes: 1000},
+			DevDelta{DevStat{When: t1}, 2 * time.Second},
+			true},
+		{"32-bit wrap",
+			DevStat{When: t0, RBytes: wrap32 - 100, TBytes: 10},
+			DevStat{When: t1, RBytes: 400, TBytes: 20},
+			DevDelta{DevStat{When: t1, RBytes: 500, TBytes: 10}, 2 * time.Second},
+			true},
+		{"32-bit wrap of errors",
+			DevStat{When: t0, RErrors: wrap32 - 1},
+			DevStat{When: t1, RErrors: 1},
+			DevDelta{DevStat{When: t1, RErrors: 2}, 2 * time.Second},
+			true},
+		{"too much for a wrap",
+			DevStat{When: t0, RBytes: wrap32 - 100},
+			DevStat{When: t1, RBytes: wrap32/2 + 1},
+			DevDelta{}, false},
+		{"64-bit counter going backwards",
+			DevStat{When: t0, RBytes: 5 * wrap32},
+			DevStat{When: t1, RBytes: 100},
+			DevDelta{}, false},
+		{"reset of a later counter",
+			DevStat{When: t0, RBytes: 1000, Multicast: 50},
+			DevStat{When: t1, RBytes: 2000, Multicast: 10},
+			DevDelta{}, false},
+	}
+	for _, tc := range tests {
+		got, good := Delta(&tc.old, &tc.new)
+		if good != tc.good {
+			t.Errorf("%s: good %v, want %v", tc.name, good, tc.good)
+			continue
+		}
+		if good && got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGenDeltas(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	old := Stats{
+		"eth0":  {When: t0, RBytes: 1000, TBytes: 1000},
+		"eth1":  {When: t0, RBytes: wrap32 - 10, TBytes: 100},
+		"idle0": {When: t0, TBytes: 100},
+		"gone0": {When: t0, RBytes: 1000},
+		"rst0":  {When: t0, RBytes: 5 * wrap32},
+	}
+	cur := Stats{
+		"eth0":  {When: t1, RBytes: 1500, TBytes: 1100},
+		"eth1":  {When: t1, RBytes: 10, TBytes: 200},
+		"idle0": {When: t1, TBytes: 200},
+		"new0":  {When: t1, RBytes: 1000},
+		"rst0":  {When: t1, RBytes: 10},
+	}
+	dt := GenDeltas(old, cur)
+	if got, want := dt.Members(), []string{"eth0", "eth1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got devices %v, want %v", got, want)
+	}
+	if d := dt["eth0"]; d.RBytes != 500 || d.TBytes != 100 || d.Delta != time.Second {
+		t.Errorf("eth0: got %+v", d)
+	}
+	if d := dt["eth1"]; d.RBytes != 20 || d.TBytes != 100 {
+		t.Errorf("eth1 (wrapped): got %+v", d)
+	}
+
+	if got, want := Resets(old, cur), []string{"rst0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resets: got %v, want %v", got, want)
+	}
+}
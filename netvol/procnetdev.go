@@ -0,0 +1,105 @@
+//
+// Parsing Linux's /proc/net/dev format. This isn't Linux-only, since
+// copies of /proc/net/dev can be replayed anywhere.
+//
+
+package netvol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getInt(field string, e error) (uint64, error) {
+	i, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return i, err
+	}
+	return i, e
+}
+
+// parseLine parses one device's line. The device name is everything
+// before the first ':', since old kernels run it straight into the
+// receive bytes when they're big enough ('eth0:123456789 ...') and
+// device names can't have a ':' in them.
+func parseLine(line string) (string, DevStat, error) {
+	st := DevStat{}
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", st, fmt.Errorf("no device name in '%s'", strings.TrimSpace(line))
+	}
+	devname := strings.TrimSpace(line[:colon])
+	fields := strings.Fields(line[colon+1:])
+	// We expect 16 counters, 8 each for receive and transmit.
+	if devname == "" || len(fields) != 16 {
+		return devname, st, fmt.Errorf("incorrect number of fields: %d in '%s'", len(fields), strings.TrimSpace(line))
+	}
+	var rerr error
+	st.RBytes, rerr = getInt(fields[0], rerr)
+	st.RPackets, rerr = getInt(fields[1], rerr)
+	st.RErrors, rerr = getInt(fields[2], rerr)
+	st.RDrops, rerr = getInt(fields[3], rerr)
+	st.Multicast, rerr = getInt(fields[7], rerr)
+	st.TBytes, rerr = getInt(fields[8], rerr)
+	st.TPackets, rerr = getInt(fields[9], rerr)
+	st.TErrors, rerr = getInt(fields[10], rerr)
+	st.TDrops, rerr = getInt(fields[11], rerr)
+	if rerr != nil {
+		rerr = fmt.Errorf("bad counter in '%s': %s", strings.TrimSpace(line), rerr)
+	}
+	return devname, st, rerr
+}
+
+// Warn is called with a message about problems that we work around,
+// such as lines of /proc/net/dev that we can't make sense of. It's
+// called once for each device that has them. By default it does
+// nothing.
+var Warn = func(msg string) {}
+
+// warned is the devices we've already called Warn about.
+var warned = make(map[string]bool)
+
+// ParseProcNetDev fills a Stats map from the contents of /proc/net/dev
+// (or a copy of it) as of when. Lines that can't be parsed, from
+// exotic drivers or kernels we don't know about, are skipped, and it's
+// only an error if that leaves no devices at all.
+func (s Stats) ParseProcNetDev(data []byte, when time.Time) error {
+	lines := bytes.Split(data, []byte("\n"))
+	// The first two lines are headers. Normally we should have
+	// at least a 'lo:' entry as well, so we error out if it
+	// seems to be missing.
+	if len(lines) < 3 {
+		return errors.New("no devices in /proc/net/dev")
+	}
+
+	var lerr error
+	found := 0
+	for _, line := range lines[2:] {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		devname, devst, err := parseLine(string(line))
+		if err != nil {
+			lerr = err
+			if !warned[devname] {
+				warned[devname] = true
+				Warn("skipping unparsable /proc/net/dev line: " + err.Error())
+			}
+			continue
+		}
+		devst.When = when
+		s[devname] = devst
+		found++
+	}
+	switch {
+	case found > 0:
+		return nil
+	case lerr != nil:
+		return lerr
+	}
+	return errors.New("no devices in /proc/net/dev")
+}
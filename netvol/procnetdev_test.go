@@ -0,0 +1,136 @@
+package netvol
+
+import (
+	"testing"
+	"time"
+)
+
+const procHeader = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+`
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		dev     string
+		want    DevStat
+		wantErr bool
+	}{
+		{"normal",
+			"  eth0: 1000 10 1 2 0 0 0 3 2000 20 4 5 0 0 0 0",
+			"eth0", DevStat{RBytes: 1000, RPackets: 10, RErrors: 1, RDrops: 2, Multicast: 3,
+				TBytes: 2000, TPackets: 20, TErrors: 4, TDrops: 5}, false},
+		{"name run into counters",
+			"eth0:123456789012 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0",
+			"eth0", DevStat{RBytes: 123456789012, RPackets: 10, TBytes: 2000, TPackets: 20}, false},
+		{"vlan name",
+			"eth0.100: 5 1 0 0 0 0 0 0 6 2 0 0 0 0 0 0",
+			"eth0.100", DevStat{RBytes: 5, RPackets: 1, TBytes: 6, TPackets: 2}, false},
+		{"missing fields",
+			"eth0: 1000 10 1 2 0 0 0 3 2000 20 4 5 0 0 0",
+			"eth0", DevStat{}, true},
+		{"extra fields",
+			"eth0: 1000 10 1 2 0 0 0 3 2000 20 4 5 0 0 0 0 99",
+			"eth0", DevStat{}, true},
+		{"non-numeric field",
+			"eth0: 1000 ten 1 2 0 0 0 3 2000 20 4 5 0 0 0 0",
+			"eth0", DevStat{}, true},
+		{"negative field",
+			"eth0: -1000 10 1 2 0 0 0 3 2000 20 4 5 0 0 0 0",
+			"eth0", DevStat{}, true},
+		{"no device name",
+			": 1000 10 1 2 0 0 0 3 2000 20 4 5 0 0 0 0",
+			"", DevStat{}, true},
+		{"first header line",
+			"Inter-|   Receive                                                |  Transmit",
+			"", DevStat{}, true},
+		{"second header line",
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed",
+			"", DevStat{}, true},
+		{"truncated",
+			"  eth0: 1000 10 1",
+			"eth0", DevStat{}, true},
+	}
+	for _, tc := range tests {
+		dev, st, err := parseLine(tc.line)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error %v, wanted error: %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		if dev != tc.dev {
+			t.Errorf("%s: device %q, want %q", tc.name, dev, tc.dev)
+		}
+		if !tc.wantErr && st != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, st, tc.want)
+		}
+	}
+}
+
+func TestParseProcNetDev(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		data    string
+		devs    map[string]uint64 // device to RBytes
+		wantErr bool
+	}{
+		{"normal",
+			procHeader +
+				"    lo: 500 5 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n" +
+				"  eth0: 1000 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0\n",
+			map[string]uint64{"lo": 500, "eth0": 1000}, false},
+		{"no trailing newline",
+			procHeader +
+				"    lo: 500 5 0 0 0 0 0 0 500 5 0 0 0 0 0 0",
+			map[string]uint64{"lo": 500}, false},
+		{"truncated final line",
+			procHeader +
+				"    lo: 500 5 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n" +
+				"  eth0: 1000 10 0 0",
+			map[string]uint64{"lo": 500}, false},
+		{"bad line in the middle",
+			procHeader +
+				"    lo: 500 5 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n" +
+				"  odd0: lots of traffic\n" +
+				"  eth0: 1000 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0\n",
+			map[string]uint64{"lo": 500, "eth0": 1000}, false},
+		{"blank lines",
+			procHeader + "\n    lo: 500 5 0 0 0 0 0 0 500 5 0 0 0 0 0 0\n\n",
+			map[string]uint64{"lo": 500}, false},
+		{"only headers",
+			procHeader,
+			nil, true},
+		{"nothing",
+			"",
+			nil, true},
+		{"nothing parses",
+			procHeader + "  eth0: 1000 10\n",
+			nil, true},
+	}
+	for _, tc := range tests {
+		s := make(Stats)
+		err := s.ParseProcNetDev([]byte(tc.data), when)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error %v, wanted error: %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+		if len(s) != len(tc.devs) {
+			t.Errorf("%s: got devices %v, want %v", tc.name, s.Members(), tc.devs)
+		}
+		for dev, rb := range tc.devs {
+			st, ok := s[dev]
+			switch {
+			case !ok:
+				t.Errorf("%s: no %s", tc.name, dev)
+			case st.RBytes != rb:
+				t.Errorf("%s: %s RBytes %d, want %d", tc.name, dev, st.RBytes, rb)
+			case !st.When.Equal(when):
+				t.Errorf("%s: %s When %v, want %v", tc.name, dev, st.When, when)
+			}
+		}
+	}
+}
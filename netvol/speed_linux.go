@@ -0,0 +1,28 @@
+//
+// Link speeds on Linux come from /sys/class/net/<dev>/speed, in
+// Mbit/s. Devices without a link speed (virtual ones, or ones that are
+// down) have no file or -1.
+//
+
+package netvol
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LinkSpeed returns a device's link speed in bits/sec, or 0 if it
+// doesn't have one that we know.
+func LinkSpeed(dev string) uint64 {
+	b, err := ioutil.ReadFile(filepath.Join("/sys/class/net", dev, "speed"))
+	if err != nil {
+		return 0
+	}
+	mbits, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || mbits <= 0 {
+		return 0
+	}
+	return uint64(mbits) * 1000 * 1000
+}
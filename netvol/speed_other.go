@@ -0,0 +1,14 @@
+//
+// We don't know how to get link speeds on other systems.
+//
+
+//go:build !linux && !solaris
+// +build !linux,!solaris
+
+package netvol
+
+// LinkSpeed returns a device's link speed in bits/sec, or 0 if it
+// doesn't have one that we know.
+func LinkSpeed(dev string) uint64 {
+	return 0
+}
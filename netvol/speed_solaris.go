@@ -0,0 +1,32 @@
+//
+// Link speeds on Solaris are the link kstat's ifspeed, in bits/sec.
+//
+
+package netvol
+
+import (
+	"github.com/siebenmann/go-kstat"
+)
+
+// LinkSpeed returns a device's link speed in bits/sec, or 0 if it
+// doesn't have one that we know.
+func LinkSpeed(dev string) uint64 {
+	if khandle == nil {
+		var err error
+		if khandle, err = kstat.Open(); err != nil {
+			return 0
+		}
+	}
+	ks, err := khandle.Lookup("link", 0, dev)
+	if err != nil {
+		return 0
+	}
+	if err = ks.Refresh(); err != nil {
+		return 0
+	}
+	speed, err := getUint(ks, "ifspeed", nil)
+	if err != nil {
+		return 0
+	}
+	return speed
+}
@@ -1,10 +1,10 @@
 //
 // Report on network device bandwidth and packet count, in per-second
 // numbers, for however many network devices you want to at once.
-// Reports can be in MB/s or KB/s and can include timestamps. Network
-// devices can be 'all active devices', specific devices, or wildcards
-// (because Chris is lazy), and we also support some special names too
-// just because.
+// Reports can be in MB/s, KB/s, bits/s or units adapted to the volume
+// and can include timestamps. Network devices can be 'all active
+// devices', specific devices, or wildcards (because Chris is lazy),
+// and we also support some special names too just because.
 //
 // Author: Chris Siebenmann
 //
@@ -13,174 +13,143 @@
 package main
 
 import (
+	"cmp"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math"
+	"net"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/siebenmann/netvolmon/netvol"
 )
 
-// low rent sets of strings.
-type set map[string]struct{}
+// low rent sets.
+type set[T cmp.Ordered] map[T]struct{}
 
-func (s set) add(dev string) {
-	s[dev] = struct{}{}
+func (s set[T]) add(v T) {
+	s[v] = struct{}{}
 }
 
-func (s set) addlist(lst []string) {
+func (s set[T]) addlist(lst []T) {
 	for _, k := range lst {
 		s.add(k)
 	}
 }
 
-func (s set) remove(dev string) {
-	delete(s, dev)
+func (s set[T]) remove(v T) {
+	delete(s, v)
 }
 
-func (s set) members() []string {
-	keys := make([]string, len(s))
-	i := 0
-	for k := range s {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-	return keys
+func (s set[T]) members() []T {
+	return sortedKeys(s)
 }
 
-func (s set) isin(name string) bool {
-	_, ok := s[name]
+func (s set[T]) isin(v T) bool {
+	_, ok := s[v]
 	return ok
 }
 
-// netinfo is our central point for network interface information
-// it is filled in setupNetinfo(), which is system-specific.
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// netInfo is our central point for network interface information.
+// The config's is filled in by setupNetinfo(), which is
+// system-specific, or by the setup for another source of stats.
 type netInfo struct {
 	ipmap        ipMap
 	ifaces       []string
-	loopbacks    set
-	pointtopoint set
+	loopbacks    set[string]
+	pointtopoint set[string]
+	// descriptions, from eg Linux's ifalias. Devices without
+	// one aren't present.
+	descs map[string]string
+	// interface indexes (ifindex), for matching up with other
+	// tools and SNMP.
+	ifindex map[string]int
+	// alternate names (Linux altnames) to the device they're for.
+	altnames map[string]string
+	// MACs, MTUs and so on, for -W. Not every source has them.
+	hw map[string]ifaceInfo
 }
 
-var netinfo netInfo
+// newNetinfo returns an empty netInfo, ready to be filled.
+func newNetinfo() *netInfo {
+	return &netInfo{
+		ipmap:        make(ipMap),
+		loopbacks:    make(set[string]),
+		pointtopoint: make(set[string]),
+		descs:        make(map[string]string),
+		ifindex:      make(map[string]int),
+		altnames:     make(map[string]string),
+		hw:           make(map[string]ifaceInfo),
+	}
+}
 
 //
 //
 
-// A DevStat represents a moment in time snapshot of a network device's
-// current statistics.
-type DevStat struct {
-	When     time.Time
-	RBytes   uint64
-	TBytes   uint64
-	RPackets uint64
-	TPackets uint64
-	// TODO: error stats?
-}
-
-// A DevDelta represents the difference between two DevStats. It has
-// the same fields, plus a Delta that is the time difference between
-// them.
-type DevDelta struct {
-	DevStat
-	Delta time.Duration
-}
-
-// subChecked subtracts two numbers if it looks like there hasn't
-// been a counter overflow. It preserves a running flag of good
-// vs bad if its particular check is good, otherwise returns 0
-// and false.
-func subChecked(a, b uint64, good bool) (uint64, bool) {
-	if a <= b {
-		return b - a, good
-	}
-	return 0, false
-}
-
-// Delta computes the change between two DevStats and returns a delta
-// along with an indicator if it's good. Deltas are bad if there appears
-// to be counter rollovers between the first and second stats.
-func Delta(oldst, newst *DevStat) (DevDelta, bool) {
-	good := true
-
-	n := DevDelta{}
-	n.Delta = newst.When.Sub(oldst.When)
-	n.When = newst.When
-	n.RBytes, good = subChecked(oldst.RBytes, newst.RBytes, good)
-	n.TBytes, good = subChecked(oldst.TBytes, newst.TBytes, good)
-	n.RPackets, good = subChecked(oldst.RPackets, newst.RPackets, good)
-	n.TPackets, good = subChecked(oldst.TPackets, newst.TPackets, good)
-	return n, good
-}
-
-// Stats represents a collection of device stats, one entry per device.
-//
-// Concrete system-dependent support for this creates a .Fill() method
-// that fills a Stats map with a point in time snapshot of available
-// network device stats. So far only Linux is supported.
-type Stats map[string]DevStat
-
-// Deltas represents the delta between two device stats, one entry per device
-type Deltas map[string]DevDelta
+// Our statistics types and how to get them come from the netvol
+// package; these save us from writing netvol. everywhere.
+type DevStat = netvol.DevStat
+type DevDelta = netvol.DevDelta
+type Stats = netvol.Stats
+type Deltas = netvol.Deltas
+
+// onlyDevices is set once we know we only care about specific devices,
+// so that we can pass them to fillStats.
+var onlyDevices []string
+
+// fillStats is where our stats come from. Normally that's this
+// machine, but -snmp, -remote and -replay replace it.
+var fillStats = func(s Stats, devs []string) error {
+	return s.FillDevices(devs)
+}
 
-// oh for generic functions. this is cut and paste but that's life.
-func (s Stats) members() []string {
-	keys := make([]string, len(s))
-	i := 0
-	for k := range s {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-	return keys
+// A statsSource is where a monitor gets its stats from.
+type statsSource interface {
+	fill(s Stats, devs []string) error
 }
 
-func (d Deltas) members() []string {
-	keys := make([]string, len(d))
-	i := 0
-	for k := range d {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-	return keys
+// fillFunc makes a function into a statsSource.
+type fillFunc func(s Stats, devs []string) error
+
+func (f fillFunc) fill(s Stats, devs []string) error {
+	return f(s, devs)
 }
 
-// Generate a set of deltas between two Stats. Devices can appear and
-// disappear; only devices that are in both Stats are included in the
-// deltas. We skip any devices that appear to have had counter overflow
-// and any devices that appear to be totally inactive, with no bytes
-// ever transmitted or received.
-func genDeltas(oldinfo, newinfo Stats) Deltas {
-	d := make(Deltas)
-	for devname, nv := range newinfo {
-		// Skip interfaces that seem to be totally inactive.
-		// Our standard for 'totally inactive' is no bytes
-		// received, because systems can try to send stuff
-		// out on dead interfaces for reasons.
-		//
-		// It isn't sufficient to check the interface's
-		// FlagUp, because we can have up but totally
-		// inactive interfaces.
-		if nv.RBytes == 0 {
-			continue
-		}
-		ov, ok := oldinfo[devname]
-		if !ok {
-			continue
-		}
-		delta, good := Delta(&ov, &nv)
-		if good {
-			d[devname] = delta
-		}
-	}
-	return d
+// A clock is where a monitor gets the time from, and when it's time
+// for its next report. sleep waits for d, for -quick's short sample.
+type clock interface {
+	now() time.Time
+	ticks() <-chan time.Time
+	sleep(d time.Duration)
 }
 
+// realClock is the clock on the wall, with ticks every -d (aligned
+// if we were asked to).
+type realClock struct{}
+
+func (realClock) now() time.Time          { return time.Now() }
+func (realClock) ticks() <-chan time.Time { return reportTicks() }
+func (realClock) sleep(d time.Duration)   { time.Sleep(d) }
+
+// netnsName is the network namespace we're watching, if it's not ours.
+var netnsName string
+
 //
 //
 const (
@@ -188,28 +157,132 @@ const (
 	mB = kB * 1024
 	gB = mB * 1024
 
+	// Network people count bits in powers of ten. These are the
+	// number of bytes in each.
+	kBit = 1000.0 / 8
+	mBit = kBit * 1000
+	gBit = mBit * 1000
+
+	// Packet rates scale in powers of ten, like everyone else
+	// does them.
+	kP = 1000
+	mP = kP * 1000
+
 	// HMS is our timestamp format for -T. It omits the date for space.
 	// This is not expected to usually matter.
 	HMS = "15:04:05"
+	// HMSMilli is HMS for intervals that aren't whole seconds.
+	HMSMilli = "15:04:05.000"
+	// -TT's formats, for when the date does matter.
+	fullStamp      = time.RFC3339
+	fullStampMilli = "2006-01-02T15:04:05.000Z07:00"
 )
 
-var showTimestamp bool
-var showZero bool
-var incLo bool
+// stampFormat is the timestamp format we actually use for -T and
+// other notes.
+var stampFormat = HMS
+var fullStamps, utcStamps bool
+
+// stamp formats a timestamp for -T and other notes in reports.
+func stamp(t time.Time) string {
+	if utcStamps {
+		t = t.UTC()
+	}
+	return t.Format(stampFormat)
+}
+
+// showElapsed is -elapsed, and runStart is what it counts from, the
+// time of our first stats.
+var showElapsed bool
+var runStart time.Time
+
+// elapsedStamp formats how long into the run a time is, as
+// '+HH:MM:SS', with milliseconds if our timestamps have them.
+func elapsedStamp(t time.Time) string {
+	d := t.Sub(runStart)
+	if d < 0 {
+		d = 0
+	}
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	sec := int(d/time.Second) % 60
+	if stampFormat == HMSMilli || stampFormat == fullStampMilli {
+		ms := int(d/time.Millisecond) % 1000
+		return fmt.Sprintf("+%02d:%02d:%02d.%03d", h, m, sec, ms)
+	}
+	return fmt.Sprintf("+%02d:%02d:%02d", h, m, sec)
+}
+
 var duration time.Duration
 var blankline bool
 
-var bwUnits = "MB/s"
-var bwDiv float64 = mB
+// A config is the options that a monitor watches and reports with.
+// main fills one in from our command line (and config file), so
+// anything else that wants a monitor with different settings can
+// make its own.
+type config struct {
+	incLo         bool
+	showTimestamp bool
+	showZero      bool
+	showDescs     bool
+	showTotal     bool
+	scalePkts     bool
+	quickSample   time.Duration
+
+	// reportCount is how many reports to make before we stop, or
+	// zero to run until we're interrupted.
+	reportCount int
+
+	// bwUnits and bwDiv are our fixed bandwidth units, or "" and 0
+	// for adaptive ones.
+	bwUnits string
+	bwDiv   float64
+	// useBits is set if we report bandwidth in bits per second. It
+	// only matters for adaptive units; fixed units just set bwUnits
+	// and bwDiv.
+	useBits bool
+	// perRateUnits is set if every rate we print gets its own units.
+	perRateUnits bool
+
+	// netinfo is what we know about the devices we're watching.
+	netinfo *netInfo
+	// source is where our stats come from, and clock our time.
+	source statsSource
+	clock  clock
+}
+
+// newConfig returns a config with our defaults, watching this
+// machine's devices (or whatever fillStats has been set to get).
+func newConfig() *config {
+	return &config{
+		bwUnits: "MB/s",
+		bwDiv:   mB,
+		netinfo: newNetinfo(),
+		source: fillFunc(func(s Stats, devs []string) error {
+			return fillStats(s, devs)
+		}),
+		clock: realClock{},
+	}
+}
 
 // getBwDiv is given the raw bytes-per-second figure and returns the
 // correct bandwidth divisor for it and a label string.
 // If an explicit bandwidth unit is already set, it is used. Otherwise
 // we base the decision on the b-p-s value, switching over to the next
 // unit up at 2,000.
-func getBwDiv(bps float64) (float64, string) {
-	if bwUnits != "" {
-		return bwDiv, bwUnits
+func (c *config) getBwDiv(bps float64) (float64, string) {
+	if c.bwUnits != "" {
+		return c.bwDiv, c.bwUnits
+	}
+	if c.useBits {
+		switch {
+		case bps >= (2 * gBit):
+			return gBit, "Gbit/s"
+		case bps >= (2 * mBit):
+			return mBit, "Mbit/s"
+		default:
+			return kBit, "Kbit/s"
+		}
 	}
 	switch {
 	case bps >= (2 * gB):
@@ -221,45 +294,460 @@ func getBwDiv(bps float64) (float64, string) {
 	}
 }
 
+// getRateDiv is like getBwDiv for adaptive units, except that it also
+// goes all the way down to plain bytes (or bits) per second. It's used
+// when every rate gets its own units (-A).
+func (c *config) getRateDiv(bps float64) (float64, string) {
+	switch {
+	case c.useBits && bps < (2*kBit):
+		return 1.0 / 8, "bit/s"
+	case !c.useBits && bps < (2*kB):
+		return 1, "B/s"
+	}
+	return c.getBwDiv(bps)
+}
+
+// getPktDiv is the packet rate version of getBwDiv, used if we're
+// scaling packet rates (-K). It uses the same 2,000 switchover point.
+func getPktDiv(pps float64) (float64, string) {
+	switch {
+	case pps >= (2 * mP):
+		return mP, "Mpps"
+	case pps >= (2 * kP):
+		return kP, "Kpps"
+	default:
+		return 1, "pps"
+	}
+}
+
+// lineExtras is the optional extra information that goes on a
+// device's report line, beyond its basic rates.
+type lineExtras struct {
+	quick   bool
+	burst   bool
+	rxTrend string
+	txTrend string
+	quota   string
+	// Moving average and session peak rates in bytes/sec, if
+	// avg or peaks is set.
+	avg            bool
+	avgRx, avgTx   float64
+	peaks          bool
+	peakRx, peakTx float64
+	// Bytes so far this run, if cum is set.
+	cum          bool
+	cumRx, cumTx uint64
+	// The change in rates from the last interval, in bytes/sec,
+	// if change is set.
+	change             bool
+	rxChange, txChange float64
+	// Sparklines of recent rates, if we're drawing them.
+	rxSpark, txSpark string
+	// The bond or team this device is a member of, if we're
+	// showing it under that (-slaves).
+	master string
+	// Whether the device is meeting an -alert condition.
+	alerting bool
+	// Rates as percentages of link speed, if util is set.
+	util           bool
+	rxUtil, txUtil float64
+	// The device's description, with -D, and its ifindex. We
+	// can't look these up from the name on the line, which may be
+	// an alias.
+	desc    string
+	ifindex int
+}
+
+// printRatePair prints a labeled pair of extra RX and TX rates (in
+// bytes/sec) on a device's line, in the same units as the line.
+func printRatePair(c *config, label string, rx, tx, bwD float64) {
+	if c.perRateUnits {
+		rxD, rxU := c.getRateDiv(rx)
+		txD, txU := c.getRateDiv(tx)
+		fmt.Fprintf(out, "   %s: %6.2f %-6s RX %6.2f %-6s TX",
+			label, rx/rxD, rxU, tx/txD, txU)
+	} else {
+		fmt.Fprintf(out, "   %s: %6.2f RX %6.2f TX", label, rx/bwD, tx/bwD)
+	}
+}
+
 // printDelta prints the per-second rates for a given device given its
-// DevDelta. Bandwidth is scaled.
-func printDelta(devname string, dt DevDelta) {
+// DevDelta and any extras. Bandwidth is scaled. Trends go right after
+// the RX and TX rates; bursts are marked at the end of the line.
+func printDelta(c *config, devname string, dt DevDelta, ex lineExtras) {
+	if layoutName == "narrow" {
+		printNarrow(c, devname, dt, ex)
+		return
+	}
 	persec := float64(dt.Delta) / float64(time.Second)
-	bwD, bwU := getBwDiv(math.Max(float64(dt.RBytes), float64(dt.TBytes)) / persec)
+	bwD, bwU := c.getBwDiv(math.Max(float64(dt.RBytes), float64(dt.TBytes)) / persec)
 	persecbytes := persec * bwD
 
-	if showTimestamp {
-		fmt.Printf("%-8s %8s ", devname, dt.When.Format(HMS))
+	// Heat coloring would turn off -highlight.
+	hot := func(rate float64, s string) string {
+		if ex.alerting && alertHighlight {
+			return s
+		}
+		return heat(devname, rate, s)
+	}
+	if ex.master != "" {
+		devname = "  " + devname
+	}
+	if ex.alerting && alertHighlight {
+		fmt.Fprint(out, highlightOn)
+	}
+	fitNames(devname)
+	fmt.Fprintf(out, "%s ", fmtName(devname))
+	if c.showTimestamp {
+		fmt.Fprintf(out, "%8s ", stamp(dt.When))
+	}
+	if showElapsed {
+		fmt.Fprintf(out, "%s ", elapsedStamp(dt.When))
+	}
+	// Trend markers are empty unless we're showing trends.
+	if c.perRateUnits {
+		rx := float64(dt.RBytes) / persec
+		tx := float64(dt.TBytes) / persec
+		rxD, rxU := c.getRateDiv(rx)
+		txD, txU := c.getRateDiv(tx)
+		fmt.Fprintf(out, "%s %-6s RX%s %s %-6s TX%s   ",
+			hot(rx, fmt.Sprintf("%6.2f", rx/rxD)), rxU, ex.rxTrend,
+			hot(tx, fmt.Sprintf("%6.2f", tx/txD)), txU, ex.txTrend)
+	} else {
+		fmt.Fprintf(out, "%s RX%s %s TX%s (%s)   ",
+			hot(float64(dt.RBytes)/persec, fmt.Sprintf("%6.2f", float64(dt.RBytes)/persecbytes)), ex.rxTrend,
+			hot(float64(dt.TBytes)/persec, fmt.Sprintf("%6.2f", float64(dt.TBytes)/persecbytes)), ex.txTrend,
+			bwU)
+	}
+	if c.scalePkts {
+		pD, pU := getPktDiv(math.Max(float64(dt.RPackets), float64(dt.TPackets)) / persec)
+		fmt.Fprintf(out, "packets: %6.2f RX %6.2f TX (%s)",
+			float64(dt.RPackets)/persec/pD,
+			float64(dt.TPackets)/persec/pD,
+			pU)
 	} else {
-		fmt.Printf("%-8s ", devname)
+		fmt.Fprintf(out, "packets/sec: %5.0f RX %5.0f TX",
+			float64(dt.RPackets)/persec,
+			float64(dt.TPackets)/persec)
+	}
+	if layoutName == "wide" {
+		printWide(dt)
+	}
+	if ex.rxSpark != "" {
+		fmt.Fprintf(out, "   %s RX %s TX", ex.rxSpark, ex.txSpark)
+	}
+	if ex.change {
+		printChange(c, ex.rxChange, ex.txChange, bwD)
+	}
+	if ex.avg {
+		printRatePair(c, "avg", ex.avgRx, ex.avgTx, bwD)
+	}
+	if ex.peaks {
+		printRatePair(c, "peak", ex.peakRx, ex.peakTx, bwD)
+	}
+	if ex.cum {
+		fmt.Fprintf(out, "   total: %9s RX %9s TX", fmtBytes(ex.cumRx), fmtBytes(ex.cumTx))
+	}
+	if ex.util {
+		fmt.Fprintf(out, "   util: %5.1f%% RX %5.1f%% TX", ex.rxUtil, ex.txUtil)
+	}
+	if ex.quick {
+		fmt.Fprintf(out, "  (quick %s sample)", dt.Delta.Round(time.Millisecond))
+	}
+	if ex.burst {
+		fmt.Fprintf(out, "  BURST")
+	}
+	if ex.quota != "" {
+		fmt.Fprintf(out, "   %s", ex.quota)
 	}
-	fmt.Printf("%6.2f RX %6.2f TX (%s)   packets/sec: %5.0f RX %5.0f TX\n",
-		float64(dt.RBytes)/persecbytes,
-		float64(dt.TBytes)/persecbytes,
-		bwU,
-		float64(dt.RPackets)/persec,
-		float64(dt.TPackets)/persec)
+	if ex.desc != "" {
+		fmt.Fprintf(out, "   %s", ex.desc)
+	}
+	if ex.alerting && alertHighlight {
+		fmt.Fprint(out, highlightOff)
+	}
+	fmt.Fprintln(out)
 }
 
-func processLoop(devices []string, report bool, exlist []string) {
-	var keys []string
+// reportDeltas reports on one interval's worth of deltas for the
+// given devices, skipping excluded ones (and loopbacks unless asked
+// for them). This is also where all of our other per-interval
+// processing hangs off. Quick intervals are the initial -quick sample;
+// they're marked as such and don't count towards burst detection.
+func reportDeltas(c *config, dt Deltas, keys []string, excludes *excluder, quick bool) {
+	if tuiMode {
+		tuiMu.Lock()
+		defer tuiMu.Unlock()
+	}
+	outFormat.begin(c.clock.now())
 
-	oldst := make(Stats)
-	e := oldst.Fill()
-	if e != nil {
-		log.Fatal("error on initial filling: ", e)
+	if showLinkState {
+		checkLinks(keys, c.clock.now())
+	}
+	if len(pendingResets) > 0 {
+		reportResets()
+	}
+
+	// When we're watching everything, VLANs still need rolling
+	// up every time.
+	if vlanMode == "rollup" {
+		keys = vlanKeys(keys)
+	}
+	if sortBy != "name" {
+		keys = sortKeys(dt, keys)
+	}
+
+	// Size the name column for everything we might show, so that
+	// all of this interval's lines line up.
+	for _, k := range keys {
+		if (c.incLo || !c.netinfo.loopbacks.isin(k)) && !excludes.isin(k) {
+			fitNames(devLabel(k))
+		}
+	}
+	for _, g := range devGroups {
+		fitNames(g.name)
+	}
+	if c.showTotal {
+		fitNames(totalName)
 	}
 
-	excludes := make(set)
-	excludes.addlist(exlist)
+	var samples []hookSample
+	var sampleWhen time.Time
+	var exported []string
+	shown := 0
+	var total DevDelta
+	for _, k := range keys {
+		if !c.incLo && c.netinfo.loopbacks.isin(k) {
+			continue
+		}
+		if excludes.isin(k) {
+			continue
+		}
 
+		// We might not have stats for some device
+		// specified on the command line (perhaps
+		// it disappeared).
+		v, ok := dt[k]
+		if !ok {
+			continue
+		}
+		if c.showTotal {
+			addTotal(&total, v)
+		}
+
+		var ex lineExtras
+		ex.quick = quick
+		ex.ifindex = c.netinfo.ifindex[k]
+		if c.showDescs {
+			ex.desc = c.netinfo.descs[k]
+		}
+		ex.burst = burstFactor > 0 && !quick && isBurst(k, v)
+		if ex.burst && desktopNotify {
+			notifyBurst(c, k, v)
+		}
+		if showTrend || showChange {
+			prev, cur, seen := noteRates(k, v)
+			if showTrend {
+				ex.rxTrend, ex.txTrend = trendFor(prev, cur, seen)
+			}
+			if showChange && seen {
+				ex.change = true
+				ex.rxChange, ex.txChange = cur.rx-prev.rx, cur.tx-prev.tx
+			}
+		}
+		if sparkWidth > 0 && !quick {
+			ex.rxSpark, ex.txSpark = sparkFor(k, v)
+		}
+		if avgWindow > 0 && !quick {
+			ex.avg = true
+			ex.avgRx, ex.avgTx = movingAvg(k, v)
+		}
+		noteDelta(k, v, ex.burst)
+		if !quick {
+			notePercentiles(k, v)
+		}
+		if showUtil {
+			ex.rxUtil, ex.txUtil, ex.util = utilization(k, v)
+		}
+		if showPeaks {
+			ex.peaks = true
+			ex.peakRx, ex.peakTx = devPeaks(k)
+		}
+		if showCum {
+			ex.cum = true
+			ex.cumRx, ex.cumTx = devTotals(k)
+		}
+		if quotaBytes > 0 {
+			noteQuota(k, v)
+			ex.quota = quotaStatus(k)
+		}
+		if len(alerts) > 0 {
+			ex.alerting = checkAlerts(c, k, v)
+		}
+		if chsink != nil {
+			chsink.add(k, v)
+		}
+		if sqlsink != nil {
+			sqlsink.add(k, v)
+		}
+		if gsink != nil {
+			gsink.add(k, v)
+		}
+		if ssink != nil {
+			ssink.add(k, v)
+		}
+		if msink != nil {
+			msink.add(k, v, ex.ifindex)
+		}
+		if sysLogTo != nil {
+			sysLogDevice(k, v)
+		}
+		if chartDir != "" {
+			noteHistory(k, v)
+		}
+		if execSample != "" {
+			samples = append(samples, newHookSample(k, v))
+			sampleWhen = v.When
+		}
+		if listenAddr != "" {
+			exported = append(exported, k)
+			continue
+		}
+		if !c.showZero && v.RBytes == 0 && v.TBytes == 0 {
+			continue
+		}
+		// -top only limits what we show; everything else
+		// still sees every device.
+		if topN > 0 && shown >= topN {
+			continue
+		}
+		shown++
+		outFormat.device(c, devLabel(k), v, ex)
+		if showQueues {
+			reportQueues(c, k, quick)
+		}
+		if showSlaves {
+			for _, sl := range slavesOf(k) {
+				if sv, ok := dt[sl]; ok {
+					sx := lineExtras{quick: quick, master: k, ifindex: c.netinfo.ifindex[sl]}
+					if c.showDescs {
+						sx.desc = c.netinfo.descs[sl]
+					}
+					outFormat.device(c, sl, sv, sx)
+				}
+			}
+		}
+	}
+	// Groups and the total cover every device in them, even ones
+	// that -top didn't show.
+	for _, g := range devGroups {
+		if listenAddr != "" {
+			break
+		}
+		gd := groupDelta(g, dt)
+		if gd.Delta > 0 && (c.showZero || gd.RBytes > 0 || gd.TBytes > 0) {
+			outFormat.device(c, g.name, gd, lineExtras{quick: quick})
+		}
+	}
+	if c.showTotal && listenAddr == "" && total.Delta > 0 &&
+		(c.showZero || total.RBytes > 0 || total.TBytes > 0) {
+		outFormat.device(c, totalName, total, lineExtras{quick: quick})
+	}
+	if procTop > 0 {
+		printTopProcs(c)
+	}
+	if ethtoolDevs != "" {
+		printEthtool()
+	}
+	outFormat.end()
+	if listenAddr != "" {
+		promUpdate(dt, exported)
+	}
+	flushOut()
+	if chsink != nil {
+		chsink.flush()
+	}
+	if sqlsink != nil {
+		sqlsink.flush()
+	}
+	if gsink != nil {
+		gsink.flush()
+	}
+	if ssink != nil {
+		ssink.flush()
+	}
+	if msink != nil {
+		msink.flush()
+	}
+	if execSample != "" && len(samples) > 0 {
+		runSampleHook(sampleWhen, samples)
+	}
+}
+
+// totalName is the device name of -t's total row.
+const totalName = "TOTAL"
+
+// addTotal adds a device's interval into the running total. All of
+// an interval's deltas should cover the same time; if they don't,
+// we use the longest.
+func addTotal(total *DevDelta, v DevDelta) {
+	total.RBytes += v.RBytes
+	total.TBytes += v.TBytes
+	total.RPackets += v.RPackets
+	total.TPackets += v.TPackets
+	total.RErrors += v.RErrors
+	total.TErrors += v.TErrors
+	total.RDrops += v.RDrops
+	total.TDrops += v.TDrops
+	total.Multicast += v.Multicast
+	if v.Delta > total.Delta {
+		total.Delta = v.Delta
+		total.When = v.When
+	}
+}
+
+// chsink is our ClickHouse sink, if we have one.
+var chsink *chSink
+
+// sqlsink is our -sql sink, if we have one.
+var sqlsink *sqlSink
+
+// gsink is our Graphite sink, if we have one.
+var gsink *graphiteSink
+
+// ssink is our statsd sink, if we have one.
+var ssink *statsdSink
+
+// msink is our MQTT sink, if we have one.
+var msink *mqttSink
+
+// makeExcluder makes our excluder from -x's specifiers, plus all of
+// the point to point devices for -P.
+func makeExcluder(c *config, exlist []string, noPtP bool) *excluder {
+	if noPtP {
+		exlist = append(exlist[:len(exlist):len(exlist)], c.netinfo.pointtopoint.members()...)
+	}
+	return newExcluder(c.netinfo, exlist)
+}
+
+// chooseDevices works out which devices we're watching from the
+// device specifiers we were given (if any) and a full set of stats,
+// and sets up everything else that depends on that.
+func chooseDevices(c *config, devices []string, oldst Stats, excludes *excluder) ([]string, error) {
+	setupAliases(c.netinfo, devices)
+
+	var keys []string
 	if len(devices) > 0 {
-		keys = expandDevList(devices, oldst, exlist)
+		var err error
+		keys, err = expandDevList(c.netinfo, devices, oldst, excludes)
+		if err != nil {
+			return nil, err
+		}
 
 		// With -x/-P, we might wind up eliminating all devices
 		// to monitor. We'd better check that explicitly.
 		if len(keys) == 0 {
-			log.Fatal("wound up with no devices to monitor!")
+			return nil, noDevices("wound up with no devices to monitor!")
 		}
 	} else {
 		// set up keys for the report flag
@@ -269,7 +757,7 @@ func processLoop(devices []string, report bool, exlist []string) {
 		keys = make([]string, 0, len(oldst))
 		for k, v := range oldst {
 			if (v.RBytes == 0) ||
-				(!incLo && netinfo.loopbacks.isin(k)) ||
+				(!c.incLo && c.netinfo.loopbacks.isin(k)) ||
 				excludes.isin(k) {
 				continue
 			}
@@ -282,100 +770,199 @@ func processLoop(devices []string, report bool, exlist []string) {
 		// in theory we could have a new network device appear;
 		// in practice, well, we error out here.
 		if len(keys) == 0 {
-			log.Fatal("wound up with no devices to monitor!")
+			return nil, noDevices("wound up with no devices to monitor!")
 		}
 	}
 
-	// Report on what devices we'd use.
-	if report {
-		fmt.Printf("netvolmon: devices would be:")
-		for _, k := range keys {
-			fmt.Printf(" %s", k)
+	if vlanMode != "" {
+		loadVLANs()
+		if len(devices) > 0 {
+			keys = vlanKeys(keys)
 		}
-		fmt.Printf("\n")
-		return
 	}
 
-	for {
-		time.Sleep(duration)
-		newst := make(Stats)
-		e = newst.Fill()
-		if e != nil {
-			log.Fatal("error refilling: ", e)
+	// Filling only some devices uses sysfs, which doesn't follow
+	// us into another network namespace.
+	if err := setupGroups(c.netinfo, oldst, excludes); err != nil {
+		return nil, err
+	}
+	if len(devices) > 0 && netnsName == "" {
+		only := make(set[string])
+		only.addlist(keys)
+		for _, g := range devGroups {
+			only.addlist(g.members)
+		}
+		if showSlaves {
+			for _, k := range keys {
+				only.addlist(slavesOf(k))
+			}
 		}
+		onlyDevices = only.members()
+	}
+	return keys, nil
+}
 
-		dt := genDeltas(oldst, newst)
+// A monitor is what we keep track of from report to report: what
+// we were asked to watch, what devices that currently means, and the
+// last stats we got. How it reports is up to its config.
+type monitor struct {
+	cfg      *config
+	devices  []string
+	exlist   []string
+	noPtP    bool
+	keys     []string
+	excludes *excluder
+	oldst    Stats
+}
 
-		// Without explicit devices specified, we report on
-		// whatever is available on each iteration. This may
-		// include newly appearing devices, which is why we
-		// don't precalculate the keys list.
-		if len(devices) == 0 {
-			keys = dt.members()
-		}
+// newMonitor takes our first stats and works out what devices we'll
+// be watching.
+func newMonitor(cfg *config, devices, exlist []string, noPtP bool) *monitor {
+	m := &monitor{cfg: cfg, devices: devices, exlist: exlist, noPtP: noPtP}
+	m.oldst = make(Stats)
+	e := cfg.source.fill(m.oldst, nil)
+	if e != nil {
+		fatalErr(exitFailure, "error on initial filling: ", e)
+	}
+	runStart = cfg.clock.now()
+	for _, v := range m.oldst {
+		runStart = v.When
+		break
+	}
 
-		reported := false
-		for _, k := range keys {
-			if !incLo && netinfo.loopbacks.isin(k) {
-				continue
-			}
-			if excludes.isin(k) {
-				continue
-			}
+	m.excludes = makeExcluder(cfg, exlist, noPtP)
+	m.keys, e = chooseDevices(cfg, devices, m.oldst, m.excludes)
+	if e != nil {
+		fatalErr(exitFailure, "", e)
+	}
+	return m
+}
 
-			// We might not have stats for some device
-			// specified on the command line (perhaps
-			// it disappeared).
-			v, ok := dt[k]
-			if !ok {
-				continue
-			}
+// report reports on what happened between two sets of stats.
+func (m *monitor) report(oldst, newst Stats, quick bool) {
+	dt := netvol.GenDeltas(oldst, newst)
+
+	// Without explicit devices specified, we report on
+	// whatever is available on each iteration. This may
+	// include newly appearing devices, which is why we
+	// don't precalculate the keys list.
+	if len(m.devices) == 0 {
+		m.keys = dt.Members()
+	}
+	noteResets(m.cfg, oldst, newst, len(m.devices) > 0, m.keys, m.excludes)
+
+	noteStats(newst)
+	reportDeltas(m.cfg, dt, m.keys, m.excludes, quick)
+}
+
+// next gets fresh stats and reports on them.
+func (m *monitor) next(quick bool) error {
+	newst, e := refillStats(m.cfg.source, onlyDevices)
+	if e != nil {
+		return e
+	}
+	m.report(m.oldst, newst, quick)
+	m.oldst = newst
+	return nil
+}
+
+func processLoop(cfg *config, devices []string, report bool, exlist []string, noPtP bool) {
+	m := newMonitor(cfg, devices, exlist, noPtP)
 
-			if !showZero && v.RBytes == 0 && v.TBytes == 0 {
+	// Report on what devices we'd use.
+	if report && zabbixDiscovery {
+		printZabbixDiscovery(cfg.netinfo, m.keys)
+		return
+	}
+	if report {
+		fmt.Printf("netvolmon: devices would be:")
+		for _, k := range m.keys {
+			fmt.Printf(" %s", k)
+		}
+		fmt.Printf("\n")
+		for _, k := range m.keys {
+			idx, ok := cfg.netinfo.ifindex[k]
+			if !ok {
 				continue
 			}
-			reported = true
-			printDelta(k, v)
+			l := fmt.Sprintf("   %-8s  ifindex %-3d %s", k, idx, cfg.netinfo.descs[k])
+			fmt.Println(strings.TrimRight(l, " "))
 		}
-		// We only produce a blank line if we actually reported
-		// on some network traffic this time around. Doing it
-		// any other way is far too annoying.
-		if reported && blankline {
-			fmt.Println()
+		for _, g := range devGroups {
+			fmt.Printf("netvolmon: group %s would be: %s\n", g.name, strings.Join(g.members, " "))
 		}
-		oldst = newst
+		return
 	}
-}
 
-//
-// Report on what IP addresses various network devices have. We abuse
-// an ipMap to do this, because an ipMap is a generic string->[]string
-// mapping.
-//
-// We respect -l and -P because that seems at least vaguely useful, but
-// we don't respect -x.
-func reportWhat(ipv6too, noPtP bool) {
-	m1 := make(ipMap)
-	for ip, ifaces := range netinfo.ipmap {
-		if !ipv6too && strings.ContainsAny(ip, ":") {
-			continue
+	// If we're resuming from a saved state, report on what's
+	// happened since then right away.
+	if resumeStats != nil {
+		m.report(resumeStats, m.oldst, false)
+	} else {
+		noteStats(m.oldst)
+	}
+
+	startKeys := m.keys
+	runHook(execStart, "start", startKeys)
+	if execStop != "" {
+		atExit(func() { runHook(execStop, "stop", startKeys) })
+	}
+
+	// step makes the next report, returning whether we're done.
+	// With -c we stop after enough reports, shutting down just as
+	// if we'd been interrupted.
+	reports := 0
+	step := func(quick bool) bool {
+		e := m.next(quick)
+		if e == errReplayDone || e == errStopped {
+			runExitFuncs()
+			return true
 		}
-		for _, iname := range ifaces {
-			if !incLo && netinfo.loopbacks.isin(iname) {
-				continue
-			}
-			if noPtP && netinfo.pointtopoint.isin(iname) {
-				continue
-			}
-			m1.add(iname, ip)
+		if e != nil {
+			runExitFuncs()
+			fatalErr(exitCollection, "error refilling: ", e)
+		}
+		reports++
+		if cfg.reportCount > 0 && reports >= cfg.reportCount {
+			runExitFuncs()
+			return true
 		}
+		return false
 	}
-	// list is pre-sorted
-	ilist := m1.members()
-	for _, iname := range ilist {
-		ips := m1[iname]
-		sort.Strings(ips)
-		fmt.Printf("%-8s  %s\n", iname, strings.Join(ips, " "))
+
+	// For a quick first look, take a short sample right away and
+	// then carry on from it.
+	if cfg.quickSample > 0 && resumeStats == nil {
+		cfg.clock.sleep(cfg.quickSample)
+		if step(true) {
+			return
+		}
+	}
+
+	var ticks <-chan time.Time
+	if replayFile == "" {
+		ticks = cfg.clock.ticks()
+	} else {
+		// Replays set their own pace, so we never wait.
+		now := make(chan time.Time)
+		close(now)
+		ticks = now
+	}
+	if daemonMode {
+		startDaemon()
+	}
+	for {
+		select {
+		case <-ticks:
+		case <-stopping:
+			runExitFuncs()
+			return
+		}
+		m.maybeReload()
+		if step(false) {
+			return
+		}
+		sdWatchdog()
 	}
 }
 
@@ -385,15 +972,26 @@ var noteStr = `
 Default is to report on all network devices that have received traffic.
 
 Network device names can include shell glob patterns (eg 'enp*f*'),
+regular expressions written with a leading '~' (eg '~^(eth|enp)[0-9]+$'),
 interface IP addresses, wildcarded IP addresses (eg '127.*'), CIDR
 netblocks (match any interface with an address in the netblock) and a
 few special names like 'me' (which tries to do an IP address lookup on
-the hostname and go from there). Use -L to see the list of special names.
+the hostname and go from there) and '@physical' (all real NICs). Use -L
+to see the list of special names.
+
+Default options can be put in ~/.netvolmonrc (or ~/.config/netvolmon/config),
+one per line (eg 'd 5s'); options on the command line override them.
+
+Exit status is 0 if all went well, 1 for most problems (2 for bad options),
+3 if no devices matched, 4 if something isn't supported on this system,
+5 if we weren't allowed to read the stats, and 6 if reading them failed
+after we'd started.
 `
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\t%s [options] [network-dev [network-dev ...]] [seconds]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\t%s config check\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\nOptions:\n")
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, noteStr)
@@ -402,28 +1000,16 @@ func usage() {
 func listSpecials() {
 	fmt.Printf("Supported special device names:\n")
 	fmt.Printf("   %-10s   device(s) with IP address of my hostname\n", "me")
-
-	// AUGH.
-	// I hate the lack of generics here and how Go does not have
-	// a 'get the keys of an arbitrary map' operation.
-	keys := make([]string, len(cslabNetNames))
-	i := 0
-	for k := range cslabNetNames {
-		keys[i] = k
-		i++
+	for _, t := range devTypeNames() {
+		fmt.Printf("   %-10s   %s\n", "@"+t, devTypeHelp[t])
 	}
-	sort.Strings(keys)
+
+	keys := sortedKeys(cslabNetNames)
 	for _, k := range keys {
 		fmt.Printf("   %-10s   device(s) with %s\n", k, cslabNetNames[k])
 	}
 
-	keys = make([]string, len(cslabMultiNames))
-	i = 0
-	for k := range cslabMultiNames {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
+	keys = sortedKeys(cslabMultiNames)
 
 	// ... what? Okay, sure, at least report it rather than being
 	// totally silent and looking like we failed.
@@ -437,6 +1023,44 @@ func listSpecials() {
 	}
 }
 
+// configCheck implements 'netvolmon config check', reporting on
+// any problems with our network names and -group definitions. It
+// returns true if everything is fine.
+func configCheck(loadErr error) bool {
+	if loadErr != nil {
+		fmt.Fprintf(os.Stderr, "netvolmon: config: %s\n", loadErr)
+		return false
+	}
+	errs := append(checkNetNames(), checkGroups()...)
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "netvolmon: config: %s\n", e)
+	}
+	if len(errs) == 0 {
+		fmt.Printf("netvolmon: configuration is okay\n")
+	}
+	return len(errs) == 0
+}
+
+// trailingSeconds returns the duration that the last argument gives
+// as a number of seconds, or 0 if it isn't one.
+func trailingSeconds(args []string) time.Duration {
+	if len(args) == 0 {
+		return 0
+	}
+	last := args[len(args)-1]
+	// We don't bother trying to limit the size of the
+	// duration via the #-of-bits argument here.
+	if dur, err := strconv.ParseUint(last, 0, 64); err == nil {
+		return time.Second * time.Duration(dur)
+	}
+	if strings.Contains(last, ".") {
+		if fdur, err := strconv.ParseFloat(last, 64); err == nil && fdur > 0 {
+			return time.Duration(fdur * float64(time.Second))
+		}
+	}
+	return 0
+}
+
 // how many boolean arguments are set. this is used to check for conflicting
 // (boolean) options.
 func howmany(bools ...bool) int {
@@ -452,64 +1076,477 @@ func howmany(bools ...bool) int {
 //
 func main() {
 	var usekb, useadaptive bool
+	var usemb, usegb bool
 	var report bool
 	var exclude string
 	var noPtP bool
 	var specials bool
 	var reportwhat, ipv6too bool
+	var outname, rotate string
+	var showVersion bool
+	var onceMode bool
+	cfg := newConfig()
 
 	// TODO: do better as far as setting the program name goes.
 	// This is low rent hardcoding.
 	log.SetPrefix("netvolmon: ")
 	log.SetFlags(0)
+	netvol.Warn = func(msg string) { log.Print(msg) }
 
 	// Flags for normal operation:
-	flag.BoolVar(&incLo, "l", false, "when reporting on everything, report on loopback too")
-	flag.BoolVar(&showTimestamp, "T", false, "include timestamps in output")
-	flag.BoolVar(&showZero, "z", false, "show devices even if they have no activity this period")
-	flag.DurationVar(&duration, "d", time.Second, "`delay` between reports")
+	flag.BoolVar(&cfg.incLo, "l", false, "when reporting on everything, report on loopback too")
+	flag.BoolVar(&cfg.showTimestamp, "T", false, "include timestamps in output")
+	flag.BoolVar(&fullStamps, "TT", false, "include full RFC 3339 timestamps, with the date and time zone, in output")
+	flag.BoolVar(&showElapsed, "elapsed", false, "include the time since we started, as +HH:MM:SS, in output (with -T, as well as the time)")
+	flag.BoolVar(&utcStamps, "utc", false, "give timestamps in UTC instead of local time")
+	flag.BoolVar(&cfg.showZero, "z", false, "show devices even if they have no activity this period")
+	flag.DurationVar(&duration, "d", time.Second, "`delay` between reports (eg 10s, or 250ms to catch microbursts)")
+	flag.BoolVar(&alignReports, "align", false, "report on wall-clock multiples of -d, eg on the minute with '-d 60s'")
 	flag.BoolVar(&usekb, "k", false, "report bandwidth in KB/s instead of MB/s")
 	flag.BoolVar(&blankline, "b", false, "print a blank line between successive reports")
 	flag.BoolVar(&useadaptive, "a", false, "adapt bandwidth units to network volume")
+	flag.BoolVar(&cfg.perRateUnits, "A", false, "adapt bandwidth units separately for every RX and TX rate, down to bytes/sec")
+	flag.BoolVar(&cfg.useBits, "bits", false, "report bandwidth in bits/sec, by default Mbit/s (-k and -a work too)")
+	flag.BoolVar(&usemb, "m", false, "report bandwidth in Mbit/s")
+	flag.BoolVar(&usegb, "g", false, "report bandwidth in Gbit/s")
+	flag.StringVar(&layoutName, "layout", "auto", "report `layout`: normal, wide (adding errors, drops and multicast), narrow (just total throughput), or auto (by terminal width)")
+	flag.BoolVar(&wideLayout, "wide", false, "the same as -layout wide")
+	flag.BoolVar(&narrowLayout, "narrow", false, "the same as -layout narrow")
+	flag.IntVar(&nameWidthFlag, "name-width", 0, "make the device name column `N` wide, shortening longer names (default as wide as the longest name)")
+	flag.StringVar(&nameTrunc, "name-trunc", "ellipsis", "how -name-width shortens names: `ellipsis` or cut")
+	flag.IntVar(&headerEvery, "H", 0, "print a header naming the columns every `N` device lines")
+	flag.BoolVar(&cfg.scalePkts, "K", false, "scale packet rates to Kpps or Mpps as needed")
+	flag.Float64Var(&burstFactor, "B", 0, "mark intervals where a device's rate is over `factor` times its trailing average")
+	flag.IntVar(&burstWindow, "burst-window", 10, "how many `intervals` of history -B averages over")
+	flag.StringVar(&sortBy, "sort", "name", "report devices in `order`: name, or busiest first by rx, tx or total")
+	flag.Var(&aliasArgs, "alias", "call devices something else in reports, given as `dev=name` (comma-separated; may be repeated)")
+	flag.Var(&groupArgs, "group", "also report a line adding up a group of devices, given as `name=devices` (comma-separated; may be repeated)")
+	flag.BoolVar(&cfg.showTotal, "t", false, "also report a TOTAL row summing all the devices being monitored")
+	flag.BoolVar(&cfg.showTotal, "total", false, "the same as -t")
+	flag.StringVar(&remoteHost, "remote", "", "watch the devices of other machines, `user@host[,...]`, by running netvolmon there over ssh")
+	flag.StringVar(&remoteCmd, "remote-cmd", "netvolmon", "the `command` to run for netvolmon on the -remote machine")
+	flag.StringVar(&alertSpec, "alert", "", "alert when a device meets any of these `conditions`, eg 'rx>100MB/s,txpps>50000'")
+	flag.IntVar(&alertFor, "alert-for", 1, "only alert once a device has met a condition for `N` intervals in a row")
+	flag.StringVar(&onAlert, "on-alert", "", "run `command` with 'sh -c' on each alert")
+	flag.BoolVar(&alertBell, "bell", false, "ring the terminal bell on each alert")
+	flag.BoolVar(&alertHighlight, "highlight", false, "show the lines of devices that are alerting in bold red")
+	flag.BoolVar(&showResets, "resets", false, "print a notice when a device's counters are reset, instead of just leaving it out of that report")
+	flag.BoolVar(&showLinkState, "linkstate", false, "print a notice when a device's link goes up or down, or the device goes away")
+	flag.StringVar(&ethtoolDevs, "ethtool", "", "also list the changes in the NIC driver statistics of these `devices` (comma-separated) each interval (Linux only)")
+	flag.BoolVar(&showQueues, "queues", false, "also show each device's traffic by hardware queue, if its driver counts that (Linux only)")
+	flag.BoolVar(&showUtil, "util", false, "also show RX and TX as percentages of each device's link speed")
+	flag.StringVar(&colorMode, "color", "auto", "color rates by how busy they are: `never`, auto (on terminals) or always")
+	flag.StringVar(&colorLevels, "color-levels", "50%,80%", "the warning and critical `levels` for -color, as rates or percentages of link speed")
+	flag.StringVar(&recordFile, "record", "", "also append every raw stats snapshot to `file`, as JSON lines")
+	flag.StringVar(&replayFile, "replay", "", "report on recorded stats instead of this machine's, from a -record `file`, a directory of /proc/net/dev copies, or 'sadf -j -- -n DEV' output")
+	flag.Float64Var(&replaySpeed, "replay-speed", 1, "replay `N` times faster than it was recorded (0 is as fast as possible)")
+	flag.StringVar(&serveAddr, "serve", "", "don't report; serve this machine's stats to -connect clients on `addr:port` (or a systemd socket)")
+	flag.StringVar(&connectAddr, "connect", "", "watch the devices of other machines running -serve at `host:port[,...]`")
+	flag.StringVar(&snmpHost, "snmp", "", "watch the interfaces of a remote switch or router `host` over SNMP, instead of this machine's")
+	flag.StringVar(&snmpCommunity, "community", "public", "the SNMP v2c `community` for -snmp")
+	flag.StringVar(&snmpVersion, "snmp-version", "2c", "the SNMP `version` for -snmp, 2c or 3 (without privacy)")
+	flag.StringVar(&snmpUser, "snmp-user", "", "the SNMP v3 `user` for -snmp")
+	flag.StringVar(&snmpAuth, "snmp-auth", "", "authenticate SNMP v3 requests with `protocol` md5 or sha (default none)")
+	flag.StringVar(&snmpAuthPass, "snmp-auth-pass", "", "the SNMP v3 authentication `password` for -snmp-auth")
+	flag.IntVar(&procTop, "procs", 0, "also list the `N` processes whose TCP connections moved the most data each interval (Linux only)")
+	flag.StringVar(&containerNames, "container", "", "also watch these Docker `containers` (comma-separated names or IDs), labeled by name")
+	flag.StringVar(&netnsName, "netns", "", "watch the devices in another (Linux) network namespace, given as an 'ip netns' `name`, a process ID or a path")
+	flag.StringVar(&vlanMode, "vlans", "", "`rollup` VLAN devices into their parents, or 'expand' parent devices to also report their VLANs")
+	flag.BoolVar(&showSlaves, "slaves", false, "also show the member devices of bonds, teams and bridges, indented under them")
+	flag.IntVar(&topN, "top", 0, "only show the `N` busiest devices each interval (by -sort, or total traffic if that's name)")
+	flag.IntVar(&sparkWidth, "spark", 0, "also draw sparklines of each device's last `N` RX and TX rates")
+	flag.BoolVar(&showPeaks, "peaks", false, "also print each device's peak rates so far this run")
+	flag.BoolVar(&showCum, "cum", false, "also print how much each device has received and sent so far this run")
+	flag.IntVar(&avgWindow, "avg", 0, "also print each device's average rates over its last `N` intervals")
+	flag.BoolVar(&showTrend, "trend", false, "mark whether each device's rates are rising or falling")
+	flag.BoolVar(&showChange, "change", false, "also print how much each device's rates changed from the last interval")
+	flag.BoolVar(&screenMode, "S", false, "redraw a single table in place every interval, like watch")
+	flag.BoolVar(&screenMode, "screen", false, "the same as -S")
+	flag.BoolVar(&tuiMode, "tui", false, "like -S, but interactive; you can sort, filter, pause, and change units")
+	flag.BoolVar(&daemonMode, "daemon", false, "run as a service: no color or screen drawing, JSON reports unless you say otherwise, and systemd notification")
+	flag.BoolVar(&printUnit, "print-unit", false, "just print a systemd unit file that runs netvolmon -daemon with the rest of these options")
+	flag.StringVar(&syslogWhat, "syslog", "", "also send `what` to syslog: 'reports' (every device's line) or 'alerts' (only -alert's)")
+	flag.StringVar(&journalWhat, "journal", "", "also send `what` to the systemd journal, with structured fields: 'reports' or 'alerts'")
+	flag.StringVar(&graphiteAddr, "graphite", "", "also push samples to Graphite's plaintext listener at `host:port`")
+	flag.StringVar(&graphitePrefix, "graphite-prefix", "netvolmon", "the `prefix` of -graphite metric names")
+	flag.StringVar(&statsdAddr, "statsd", "", "also send samples to statsd as gauges, over UDP to `host:port`")
+	flag.StringVar(&statsdPrefix, "statsd-prefix", "netvolmon", "the `prefix` of -statsd metric names")
+	flag.StringVar(&mqttBroker, "mqtt", "", "also publish each device's rates as JSON to an MQTT `broker`, host:port or mqtt[s]://[user:password@]host[:port]")
+	flag.StringVar(&mqttTopic, "mqtt-topic", "", "publish to `topic`/<device> (default netvolmon/<host>)")
+	flag.BoolVar(&mqttRetain, "mqtt-retain", false, "have the MQTT broker retain our latest messages")
+	flag.BoolVar(&statsdTags, "statsd-tags", false, "give -statsd's host and device as DogStatsD tags, instead of in metric names")
+	flag.StringVar(&chURL, "clickhouse", "", "also insert samples into ClickHouse through its HTTP interface at `URL`")
+	flag.StringVar(&chTable, "clickhouse-table", "netvolmon", "ClickHouse `table` to insert into")
+	flag.IntVar(&chBatch, "clickhouse-batch", 60, "insert into ClickHouse in batches of this many `rows`")
+	flag.StringVar(&sqlSpec, "sql", "", "also insert samples into a SQL database, given as `driver:DSN` (eg postgres:postgres://...)")
+	flag.StringVar(&sqlTable, "sql-table", "netvolmon", "SQL `table` to insert into")
+	flag.IntVar(&sqlBatch, "sql-batch", 60, "insert into the SQL database in batches of this many `rows`")
+	flag.StringVar(&chartDir, "chart", "", "when stopped, write an SVG chart of each device's rates into `directory`")
+	flag.BoolVar(&desktopNotify, "notify", false, "raise desktop notifications for -B bursts, -alert alerts and -linkstate link changes")
+	flag.StringVar(&execStart, "exec-start", "", "run `command` when monitoring starts")
+	flag.StringVar(&execSample, "exec-sample", "", "run `command` after every interval, with the interval's rates as JSON on standard input")
+	flag.StringVar(&execStop, "exec-stop", "", "run `command` when stopped")
+	flag.StringVar(&stateFile, "state", "", "save our state to `file` when stopped and resume from it when started")
+	flag.StringVar(&quotaSize, "quota", "", "track each device's RX+TX bytes against a quota of `size` (eg 500G or 1T)")
+	flag.StringVar(&quotaPeriod, "quota-period", "month", "the quota `period`: day, week or month")
+	flag.StringVar(&quotaStateFile, "quota-state", "", "keep quota usage in `file` across restarts")
+	flag.IntVar(&maxErrors, "max-errors", 10, "give up after this many `errors` in a row getting stats (0 means never)")
+	flag.IntVar(&cfg.reportCount, "c", 0, "stop after `count` reports")
+	flag.BoolVar(&onceMode, "1", false, "take a single measurement over the interval, print it even if it's zero, and exit")
+	flag.BoolVar(&onceMode, "once", false, "the same as -1")
+	flag.DurationVar(&cfg.quickSample, "quick", 0, "start with a quick sample over this short `duration` (eg 250ms) before the normal ones")
+	flag.StringVar(&formatName, "format", "text", "report in `format`: text, json, csv, influx or zabbix (zabbix_sender input)")
+	flag.StringVar(&zabbixHost, "zabbix-host", "", "the Zabbix `host` name for -format zabbix (default zabbix_sender's own)")
+	flag.BoolVar(&jsonOut, "j", false, "report each interval as a line of JSON")
+	flag.BoolVar(&jsonOut, "json", false, "the same as -j")
+	flag.BoolVar(&csvOut, "csv", false, "report in CSV, one row per device per interval")
+	flag.BoolVar(&influxOut, "influx", false, "report in InfluxDB line protocol, one line per device per interval")
+	flag.StringVar(&influxURL, "influx-url", "", "with -influx, send lines to `URL` (udp://host:port or an http(s) write URL) instead of printing them")
+	flag.StringVar(&listenAddr, "listen", "", "instead of reporting, serve Prometheus metrics on `addr:port` (or a systemd socket)")
+	flag.BoolVar(&quiet, "q", false, "quiet: print nothing but errors (reports still go to -o files, -statsd and so on)")
+	flag.BoolVar(&showSummary, "s", false, "print a summary of peak rates when stopped")
+	flag.BoolVar(&showPercentiles, "pct", false, "print each device's p50, p90, p99 and max rates when stopped")
+	flag.BoolVar(&cfg.showDescs, "D", false, "include interface descriptions (if any) in reports")
+	flag.StringVar(&outname, "o", "", "write reports to `file` instead of standard output (may use strftime-style %Y %m %d %H etc; gzip'd if it ends in .gz)")
+	flag.StringVar(&rotate, "rotate", "", "start a new -o file every `period` (hourly or daily)")
+	flag.StringVar(&rotateSize, "rotate-size", "", "when the -o file reaches `size` (eg 100M), move it to <file>.1 and start a new one")
+	flag.IntVar(&rotateKeep, "rotate-keep", 5, "keep this many `old` -o files for -rotate-size")
+	flag.BoolVar(&teeOut, "tee", false, "with -o, also write reports to standard output")
 
 	// TODO: this is kind of a hack.
-	flag.StringVar(&exclude, "x", "", "`devices` to specifically exclude (comma-separated)")
+	flag.StringVar(&netNamesFile, "netnames", "", "load special network names from `file` instead of ~/.config/netvolmon/networks")
+	flag.StringVar(&exclude, "x", "", "`devices` to specifically exclude (comma-separated; globs, IPs and so on work too)")
 	flag.BoolVar(&noPtP, "P", false, "exclude all point to point devices")
+	flag.DurationVar(&rescanEvery, "rescan", 0, "every `period` (eg 5m), take a fresh look at the network devices, as with SIGHUP")
 
 	// Special reporting flags:
 	flag.BoolVar(&report, "R", false, "just report what devices we'd monitor")
+	flag.BoolVar(&zabbixDiscovery, "zabbix-discovery", false, "just print the devices we'd monitor as Zabbix low-level discovery JSON")
 	flag.BoolVar(&specials, "L", false, "just list available special names")
-	flag.BoolVar(&reportwhat, "W", false, "just report what IPs each interface has")
+	flag.BoolVar(&reportwhat, "W", false, "just report on each interface: its state, MTU, MAC, link speed, flags and IPs")
 	// Excluding IPv6 addresses by default makes part of me wince, but
 	// for my machines it's by far the most convenient case. Arguably
 	// we only really want to exclude fe80: IPv6 addresses, because
 	// those things are everywhere and they clutter up -W's display
 	// badly.
 	flag.BoolVar(&ipv6too, "6", false, "include IPv6 IPs in -W")
+	flag.BoolVar(&verbose, "v", false, "with -W, also report each interface's driver, master, altnames and so on")
+	flag.BoolVar(&showVersion, "version", false, "just print version and build information")
+	flag.BoolVar(&versionHeader, "version-header", false, "start JSON, CSV and line protocol output with our version")
 
 	flag.Usage = usage
 	flag.Parse()
 
-	if usekb && useadaptive {
-		log.Fatal("conflicting command line arguments; see -h")
+	// This is a low-rent way of checking for conflicting arguments.
+	// We do it before reading the config file, because what's in
+	// there is only defaults for monitoring and shouldn't get in
+	// the way of -L, -W or -R.
+	monitoring := cfg.showTimestamp || fullStamps || showElapsed || cfg.showZero || usekb || cfg.useBits || usemb || usegb ||
+		cfg.perRateUnits || blankline || cfg.showDescs || cfg.scalePkts || wideLayout || narrowLayout || headerEvery > 0 || showSummary || showPercentiles ||
+		burstFactor > 0 || showTrend || showChange || avgWindow > 0 || showPeaks || showCum ||
+		sparkWidth > 0 || screenMode || tuiMode || chartDir != "" || quotaSize != "" ||
+		cfg.quickSample > 0 || formatName != "text" || jsonOut || csvOut || influxOut || listenAddr != "" ||
+		sortBy != "name" || topN > 0 || cfg.showTotal || procTop > 0 || showUtil || showQueues || ethtoolDevs != ""
+	if howmany(specials, reportwhat, report || zabbixDiscovery, monitoring) > 1 {
+		fatal("conflicting command line arguments; see -h")
 	}
-	if usekb {
-		bwUnits = "KB/s"
-		bwDiv = kB
+
+	if rc := rcFileName(); rc != "" {
+		if e := loadRCFile(rc, rcSkipper(trailingSeconds(flag.Args()) > 0)); e != nil {
+			fatal("config file: ", e)
+		}
 	}
-	if useadaptive {
-		bwUnits = ""
-		bwDiv = 0
+
+	if showVersion {
+		printVersion()
+		os.Exit(0)
 	}
 
-	// This is a low-rent way of checking for conflicting arguments
-	if howmany(specials, reportwhat, report, showTimestamp || showZero || usekb || blankline) > 1 {
-		log.Fatal("conflicting command line arguments; see -h")
+	if fullStamps {
+		cfg.showTimestamp = true
+	}
+	// -zabbix-discovery is -R in another format.
+	if zabbixDiscovery {
+		report = true
 	}
+	if howmany(usekb, useadaptive, usemb, usegb, cfg.perRateUnits) > 1 {
+		fatal("conflicting command line arguments; see -h")
+	}
+	if usemb || usegb {
+		cfg.useBits = true
+	}
+	switch {
+	case usekb && cfg.useBits:
+		cfg.bwUnits = "Kbit/s"
+		cfg.bwDiv = kBit
+	case usekb:
+		cfg.bwUnits = "KB/s"
+		cfg.bwDiv = kB
+	case usegb:
+		cfg.bwUnits = "Gbit/s"
+		cfg.bwDiv = gBit
+	case cfg.useBits:
+		cfg.bwUnits = "Mbit/s"
+		cfg.bwDiv = mBit
+	}
+	if useadaptive || cfg.perRateUnits {
+		cfg.bwUnits = ""
+		cfg.bwDiv = 0
+	}
+
+	if daemonMode {
+		setupDaemon()
+	}
+
+	// -j, -csv and -influx are shorthands for -format. The rest of
+	// our checks use them, so we set them from -format too.
+	if howmany(jsonOut, csvOut, influxOut) > 1 {
+		fatal("-j, -csv and -influx are mutually exclusive")
+	}
+	short := ""
+	switch {
+	case jsonOut:
+		short = "json"
+	case csvOut:
+		short = "csv"
+	case influxOut:
+		short = "influx"
+	}
+	if short != "" {
+		if formatName != "text" && formatName != short {
+			fatal("-format disagrees with -j, -csv or -influx")
+		}
+		formatName = short
+	}
+	outFormat = formatters[formatName]
+	if outFormat == nil {
+		fatalf("-format must be one of %s", strings.Join(formatNames(), ", "))
+	}
+	jsonOut = formatName == "json"
+	csvOut = formatName == "csv"
+	influxOut = formatName == "influx"
+
+	// -tui is -S with extras, and has all of -S's restrictions.
+	if tuiMode {
+		screenMode = true
+		outFormat = &tuiFormat{}
+	}
+
 	// -R is often given with command line arguments for obvious
 	// reasons, but neither -L nor -W respects them at all.
 	if flag.NArg() > 0 && (specials || reportwhat) {
-		log.Fatal("-L or -W given with command line arguments")
+		fatal("-L or -W given with command line arguments")
+	}
+	if verbose && !reportwhat {
+		fatal("-v only goes with -W")
+	}
+	if burstFactor < 0 || (burstFactor > 0 && burstFactor <= 1) {
+		fatal("-B's factor must be greater than 1")
+	}
+	if chBatch < 1 {
+		fatal("-clickhouse-batch must be at least 1")
+	}
+	if sqlBatch < 1 {
+		fatal("-sql-batch must be at least 1")
+	}
+	if desktopNotify && burstFactor == 0 && alertSpec == "" && !showLinkState {
+		fatal("-notify needs something to notify about: -B, -alert or -linkstate")
+	}
+	if quotaSize != "" {
+		var e error
+		quotaBytes, e = parseSize(quotaSize)
+		if e != nil {
+			fatal("-quota: ", e)
+		}
+		if quotaBytes == 0 {
+			fatal("-quota must be more than zero")
+		}
+	}
+	if quotaPeriod != "day" && quotaPeriod != "week" && quotaPeriod != "month" {
+		fatal("-quota-period must be day, week or month")
+	}
+	if quotaStateFile != "" && quotaSize == "" {
+		fatal("-quota-state requires -quota")
+	}
+	if !sortOrders[sortBy] {
+		fatal("-sort must be name, rx, tx or total")
+	}
+	if vlanMode != "" && vlanMode != "rollup" && vlanMode != "expand" {
+		fatal("-vlans must be rollup or expand")
+	}
+	if replayFile != "" && (remoteHost != "" || connectAddr != "" || snmpHost != "" || netnsName != "" || containerNames != "" || procTop > 0 || cfg.quickSample > 0) {
+		fatal("-replay can't be combined with other sources of stats, -procs or -quick")
+	}
+	if showQueues && (replayFile != "" || remoteHost != "" || connectAddr != "" || snmpHost != "") {
+		fatal("-queues only works for this machine's own devices")
+	}
+	if ethtoolDevs != "" && (replayFile != "" || remoteHost != "" || connectAddr != "" || snmpHost != "") {
+		fatal("-ethtool only works for this machine's own devices")
+	}
+	if ethtoolDevs != "" && (formatName != "text" || tuiMode || listenAddr != "") {
+		fatal("-ethtool only works with plain text reports")
+	}
+	if showLinkState && (replayFile != "" || remoteHost != "" || connectAddr != "" || snmpHost != "" || netnsName != "") {
+		fatal("-linkstate only works for this machine's own devices")
+	}
+	if replaySpeed < 0 {
+		fatal("-replay-speed can't be negative")
+	}
+	if (remoteHost != "" || connectAddr != "") && (snmpHost != "" || netnsName != "" || containerNames != "" || procTop > 0) {
+		fatal("-remote and -connect can't be combined with -snmp, -netns, -container or -procs")
+	}
+	switch snmpVersion {
+	case "2c":
+		if snmpUser != "" || snmpAuth != "" || snmpAuthPass != "" {
+			fatal("-snmp-user, -snmp-auth and -snmp-auth-pass need -snmp-version 3")
+		}
+	case "3":
+		if snmpUser == "" {
+			fatal("-snmp-version 3 needs a -snmp-user")
+		}
+		if snmpAuth != "md5" && snmpAuth != "sha" && snmpAuth != "" {
+			fatal("-snmp-auth must be md5 or sha")
+		}
+		if (snmpAuth == "") != (snmpAuthPass == "") {
+			fatal("-snmp-auth and -snmp-auth-pass go together")
+		}
+	default:
+		fatalErr(exitFailure, "", unsupported(fmt.Sprintf("SNMP version %s isn't supported, only 2c and 3", snmpVersion)))
+	}
+	if snmpHost != "" && (netnsName != "" || containerNames != "" || procTop > 0) {
+		fatal("-snmp can't be combined with -netns, -container or -procs")
+	}
+	if alertSpec != "" {
+		var err error
+		if alerts, err = parseAlerts(alertSpec); err != nil {
+			fatal("bad -alert: ", err)
+		}
+	}
+	if alertFor < 1 {
+		fatal("-alert-for must be at least 1")
+	}
+	if (onAlert != "" || alertBell || alertHighlight) && alertSpec == "" {
+		fatal("-on-alert, -bell and -highlight require -alert")
+	}
+	if procTop < 0 {
+		fatal("-procs's number of processes can't be negative")
+	}
+	if procTop > 0 && (formatName != "text" || tuiMode || listenAddr != "") {
+		fatal("-procs only works with plain text reports")
+	}
+	if topN < 0 {
+		fatal("-top's number of devices can't be negative")
+	}
+	if topN > 0 && sortBy == "name" {
+		sortBy = "total"
+	}
+	if sparkWidth < 0 {
+		fatal("-spark's number of intervals can't be negative")
+	}
+	if avgWindow < 0 {
+		fatal("-avg's number of intervals can't be negative")
+	}
+	if burstWindow < 1 {
+		fatal("-burst-window must be at least 1")
+	}
+	if screenMode && (outname != "" || blankline || formatName != "text") {
+		fatal("-S can't be combined with -o, -b, or -format (-j, -csv and so on)")
+	}
+	if listenAddr != "" && (screenMode || formatName != "text" || outname != "") {
+		fatal("-listen doesn't report, so it can't be combined with -S, -format (-j, -csv and so on) or -o")
+	}
+	if headerEvery < 0 {
+		fatal("-H's number of lines can't be negative")
+	}
+	if headerEvery > 0 && (screenMode || tuiMode || formatName != "text") {
+		fatal("-H only works with plain scrolling text reports")
+	}
+	if quiet && (screenMode || tuiMode || teeOut || alertBell) {
+		fatal("-q can't be combined with -S, -tui, -tee or -bell")
+	}
+	if influxURL != "" && !influxOut {
+		fatal("-influx-url requires -influx")
+	}
+	if influxURL != "" && outname != "" {
+		fatal("-influx-url and -o are mutually exclusive")
+	}
+	// A table that we redraw in place shouldn't have rows come
+	// and go.
+	if screenMode {
+		cfg.showZero = true
+	}
+	if rotate != "" && outname == "" {
+		fatal("-rotate requires -o")
+	}
+	if rotate != "" && rotate != "hourly" && rotate != "daily" {
+		fatal("-rotate must be 'hourly' or 'daily'")
+	}
+	if (rotateSize != "" || teeOut) && outname == "" {
+		fatal("-rotate-size and -tee require -o")
+	}
+	if syslogWhat != "" && journalWhat != "" {
+		fatal("-syslog and -journal are mutually exclusive")
+	}
+	if what := syslogWhat + journalWhat; what != "" {
+		if what != "reports" && what != "alerts" {
+			fatal("-syslog and -journal take 'reports' or 'alerts'")
+		}
+		if what == "alerts" && alertSpec == "" {
+			fatal("-syslog or -journal of alerts requires -alert")
+		}
+		sysLogReports = what == "reports"
+	}
+	if rotateKeep < 1 {
+		fatal("-rotate-keep must be at least 1")
+	}
+	var rotateBytes uint64
+	if rotateSize != "" {
+		var e error
+		if rotateBytes, e = parseSize(rotateSize); e != nil {
+			fatal("-rotate-size: ", e)
+		}
+		if rotateBytes == 0 {
+			fatal("-rotate-size must be more than zero")
+		}
+	}
+
+	// Special network names may come from a file. If it's bad,
+	// 'config check' reports that and everything else gives up.
+	explicitNames := netNamesFile != ""
+	if !explicitNames {
+		netNamesFile = defaultNetNamesFile()
+	}
+	var namesErr error
+	if netNamesFile != "" {
+		namesErr = loadNetNames(netNamesFile, explicitNames)
+	}
+
+	// 'config check' is a subcommand, not a pair of device names.
+	// Like -L it needs nothing from the network.
+	if flag.NArg() == 2 && flag.Arg(0) == "config" && flag.Arg(1) == "check" {
+		if !configCheck(namesErr) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	// 'dump' is the other end of -remote.
+	if flag.NArg() == 1 && flag.Arg(0) == "dump" {
+		runDump()
+		os.Exit(0)
+	}
+	if serveAddr != "" {
+		if netnsName != "" || snmpHost != "" || remoteHost != "" || connectAddr != "" {
+			fatal("-serve only serves this machine's own stats")
+		}
+		fatalErr(exitFailure, "", serveStats(serveAddr))
+	}
+	if namesErr != nil {
+		fatal("loading network names: ", namesErr)
+	}
+	// Finding out about bad names or groups in the middle of
+	// matching would be too late.
+	if errs := append(checkNetNames(), checkGroups()...); len(errs) > 0 {
+		fatalf("%s (see 'netvolmon config check' for everything)", errs[0])
 	}
 
 	// We deliberately don't try to go any further (eg to network
@@ -521,24 +1558,76 @@ func main() {
 
 	//
 	// Very special hack: a single trailing integer argument is
-	// interpreted as a duration in seconds.
+	// interpreted as a duration in seconds. So is a decimal one, like
+	// '0.25', for sub-second intervals.
 	//
 	// We check for doing both -d and this and usually error out.
 	args := flag.Args()
-	if len(args) > 0 {
-		l := len(args) - 1
-		// We don't bother trying to limit the size of the
-		// duration via the #-of-bits argument here.
-		dur, ok := strconv.ParseUint(args[l], 0, 64)
-		if ok == nil && dur > 0 {
-			nd := time.Second * time.Duration(dur)
-			// trivia root: we'll accept '-d 20s ... 20', just
-			// because. knock yourself out.
-			if duration != time.Second && duration != nd {
-				log.Fatal("given both -d and a trailing 'seconds' argument")
+	if nd := trailingSeconds(args); nd > 0 {
+		// trivia root: we'll accept '-d 20s ... 20', just
+		// because. knock yourself out.
+		if duration != time.Second && duration != nd {
+			fatal("given both -d and a trailing 'seconds' argument")
+		}
+		duration = nd
+		args = args[:len(args)-1]
+	}
+	if maxErrors < 0 {
+		fatal("-max-errors can't be negative")
+	}
+	if cfg.reportCount < 0 {
+		fatal("-c's count can't be negative")
+	}
+	// Something embedding a single measurement in a pipeline wants
+	// a line for every device it asked about, zero or not.
+	if onceMode {
+		if cfg.reportCount > 1 || cfg.quickSample > 0 || screenMode || listenAddr != "" {
+			fatal("-1 can't be combined with -c, -quick, -S or -listen")
+		}
+		cfg.reportCount = 1
+		cfg.showZero = true
+	}
+	if duration <= 0 {
+		fatal("-d's delay must be positive")
+	}
+	if printUnit {
+		printUnitFile()
+		os.Exit(0)
+	}
+	// Sub-second intervals need sub-second timestamps.
+	switch {
+	case fullStamps && duration%time.Second != 0:
+		stampFormat = fullStampMilli
+	case fullStamps:
+		stampFormat = fullStamp
+	case duration%time.Second != 0:
+		stampFormat = HMSMilli
+	}
+	if cfg.quickSample < 0 || cfg.quickSample >= duration {
+		fatal("-quick's duration must be shorter than the interval")
+	}
+	if rescanEvery < 0 {
+		fatal("-rescan's period can't be negative")
+	}
+	if rescanEvery > 0 && replayFile != "" {
+		fatal("-rescan doesn't apply to -replay")
+	}
+	if alignReports && replayFile != "" {
+		fatal("-replay sets its own pace, so it can't be combined with -align")
+	}
+
+	// Resuming from a state file may give us the devices to
+	// monitor, so we have to load it now.
+	if stateFile != "" && !report {
+		ss, e := loadState(stateFile)
+		if e != nil {
+			fatal("error loading state: ", e)
+		}
+		if ss != nil {
+			resumeStats = ss.Stats
+			if len(args) == 0 {
+				args = ss.Devices
 			}
-			duration = nd
-			args = args[:l]
 		}
 	}
 
@@ -546,30 +1635,56 @@ func main() {
 	// devices to display, then we assume you want to include a
 	// loopback interface if it matches one of them.
 	if len(args) > 0 {
-		incLo = true
+		cfg.incLo = true
 	}
 
-	// Load the network interface information now. Because we only
-	// load it once, we're implicitly assuming that loopback and
-	// point to point devices don't appear dynamically. This is
-	// the best we can do for reasons, although it's actually wrong
-	// (especially for PtP devices).
+	// Load the network interface information now. Because we
+	// normally only load it once, we're implicitly assuming that
+	// loopback and point to point devices don't appear dynamically.
+	// This is the best we can do for reasons, although it's actually
+	// wrong (especially for PtP devices); SIGHUP makes us load it
+	// again (see reload.go).
 	//
 	// We deliberately defer this until after all argument
 	// checking has been done so that argument errors take
 	// priority over problems here.
-	netinfo.ipmap = make(ipMap)
-	netinfo.loopbacks = make(set)
-	netinfo.pointtopoint = make(set)
-	e := setupNetinfo()
+	//
+	// This is also when we switch network namespaces, if we're
+	// going to.
+	if netnsName != "" {
+		if e := enterNetns(netnsName); e != nil {
+			fatalErr(exitFailure, "cannot enter network namespace: ", e)
+		}
+	}
+	var e error
+	switch {
+	case snmpHost != "":
+		e = setupSNMP(cfg.netinfo)
+	case replayFile != "":
+		e = setupReplay(cfg.netinfo)
+	case remoteHost != "" || connectAddr != "":
+		e = setupRemotes(cfg.netinfo)
+	default:
+		e = setupNetinfo(cfg.netinfo)
+	}
 	if e != nil {
-		log.Fatal("error on network info setup: ", e)
+		fatalErr(exitFailure, "error on network info setup: ", e)
+	}
+
+	// Containers are found through their host devices, so we
+	// need those first.
+	if containerNames != "" {
+		cdevs, e := containerDevices(cfg.netinfo, containerNames)
+		if e != nil {
+			fatalErr(exitFailure, "", e)
+		}
+		args = append(args, cdevs...)
 	}
 
 	// With device information loaded, we can now report on
 	// interface->IP mappings.
 	if reportwhat {
-		reportWhat(ipv6too, noPtP)
+		reportWhat(cfg, ipv6too, noPtP)
 		os.Exit(0)
 	}
 
@@ -577,11 +1692,155 @@ func main() {
 	// reporting)
 
 	exlist := strings.Split(exclude, ",")
+	if e := checkSpecs(args, exlist); e != nil {
+		fatalErr(exitFailure, "", e)
+	}
 	// TODO: all of this hackery around various sorts of
 	// exclusions is a code smell.
-	if noPtP {
-		exlist = append(exlist, netinfo.pointtopoint.members()...)
+
+	// We open the output file last, so that we don't create
+	// (empty) files if something else goes wrong first.
+	if outname != "" && !report {
+		of, e := newOutFile(outname, rotate, outFormat.header(), rotateBytes, rotateKeep)
+		if e != nil {
+			fatal("cannot open output file: ", e)
+		}
+		if teeOut {
+			of.tee = os.Stdout
+		}
+		atExit(func() { of.Close() })
+		out = of
+	} else if quiet && !report {
+		out = ioutil.Discard
+	} else if !report {
+		fmt.Fprint(out, outFormat.header())
+	}
+
+	if e := setupColor(); e != nil {
+		fatal(e)
+	}
+	if e := setupLayout(); e != nil {
+		fatal(e)
+	}
+	if e := setupNameWidth(); e != nil {
+		fatal(e)
+	}
+
+	if chURL != "" && !report {
+		chsink, e = newCHSink(chURL, chTable, chBatch)
+		if e != nil {
+			fatal("bad -clickhouse URL: ", e)
+		}
+		atExit(chsink.close)
+	}
+	if sqlSpec != "" && !report {
+		sqlsink, e = newSQLSink(sqlSpec, sqlTable, sqlBatch)
+		if e != nil {
+			fatal("bad -sql database: ", e)
+		}
+		atExit(sqlsink.close)
+	}
+	if (syslogWhat != "" || journalWhat != "") && !report {
+		if e := setupSysLog(); e != nil {
+			fatalErr(exitFailure, "cannot connect to the system log: ", e)
+		}
+	}
+	if mqttBroker != "" && !report {
+		if msink, e = newMQTTSink(mqttBroker, mqttTopic); e != nil {
+			fatal("bad -mqtt broker: ", e)
+		}
+		atExit(msink.close)
+	}
+	if statsdAddr != "" && !report {
+		if _, _, e := net.SplitHostPort(statsdAddr); e != nil {
+			fatal("bad -statsd address: ", e)
+		}
+		if ssink, e = newStatsdSink(statsdAddr, statsdPrefix, statsdTags); e != nil {
+			fatal("-statsd: ", e)
+		}
+	}
+	if graphiteAddr != "" && !report {
+		if _, _, e := net.SplitHostPort(graphiteAddr); e != nil {
+			fatal("bad -graphite address: ", e)
+		}
+		gsink = newGraphiteSink(graphiteAddr, graphitePrefix)
+		atExit(gsink.close)
+	}
+	if chartDir != "" && !report {
+		if fi, e := os.Stat(chartDir); e != nil || !fi.IsDir() {
+			fatalf("-chart: '%s' is not a directory", chartDir)
+		}
+		atExit(func() { writeCharts(cfg, chartDir) })
+	}
+	if stateFile != "" && !report {
+		atExit(func() {
+			if e := saveState(stateFile, args); e != nil {
+				log.Print("error saving state: ", e)
+			}
+		})
+	}
+	if recordFile != "" && !report {
+		if e := openRecord(recordFile); e != nil {
+			fatal("cannot open -record file: ", e)
+		}
+	}
+	if quotaStateFile != "" && !report {
+		if e := loadQuotas(); e != nil {
+			fatal("error loading quota state: ", e)
+		}
+		atExit(saveQuotas)
+	}
+	if influxOut && !report {
+		if e := setupInflux(influxURL); e != nil {
+			fatal("bad -influx-url: ", e)
+		}
+	}
+	if listenAddr != "" && !report {
+		if e := startExporter(listenAddr); e != nil {
+			fatal("cannot start exporter: ", e)
+		}
+	}
+	if procTop > 0 && !report {
+		if e := startProcs(); e != nil {
+			fatalErr(exitFailure, "-procs: ", e)
+		}
+	}
+	if ethtoolDevs != "" && !report {
+		if e := startEthtool(); e != nil {
+			fatalErr(exitFailure, "-ethtool: ", e)
+		}
+	}
+	if tuiMode && !report {
+		if e := tuiStart(cfg); e != nil {
+			fatal("-tui: ", e)
+		}
+	}
+	if (showSummary || showPercentiles) && !report {
+		// The summary isn't JSON, CSV or line protocol, so it
+		// mustn't get mixed into that output.
+		sumOut := out
+		if formatName != "text" {
+			sumOut = os.Stderr
+			if quiet {
+				sumOut = ioutil.Discard
+			}
+		}
+		// Exit functions run last first, so this puts the
+		// percentiles after the summary.
+		if showPercentiles {
+			atExit(func() { printPercentiles(cfg, sumOut) })
+		}
+		if showSummary {
+			atExit(func() { printSummary(cfg, sumOut) })
+		}
+	}
+	atExit(func() { netvol.Close() })
+	handleExitSignals()
+	handleReloadSignal()
+	handleSnapshotSignal(cfg)
+	if rescanEvery > 0 {
+		startRescans()
 	}
 
-	processLoop(args, report, exlist)
+	processLoop(cfg, args, report, exlist, noPtP)
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when we move it, and its report ticks come as
+// fast as processLoop wants them.
+type fakeClock struct {
+	t time.Time
+}
+
+func (fc *fakeClock) now() time.Time { return fc.t }
+
+func (fc *fakeClock) ticks() <-chan time.Time {
+	c := make(chan time.Time)
+	close(c)
+	return c
+}
+
+func (fc *fakeClock) sleep(d time.Duration) { fc.t = fc.t.Add(d) }
+
+// fakeSource hands out one of its stats for each fill, stamped with
+// the time on its clock, which then moves on by a second. Once it's
+// out of stats, it's done in the same way as a replay.
+type fakeSource struct {
+	clock *fakeClock
+	stats []Stats
+	fills int
+}
+
+func (fs *fakeSource) fill(s Stats, devs []string) error {
+	if fs.fills >= len(fs.stats) {
+		return errReplayDone
+	}
+	for dev, st := range fs.stats[fs.fills] {
+		st.When = fs.clock.t
+		s[dev] = st
+	}
+	fs.fills++
+	fs.clock.t = fs.clock.t.Add(time.Second)
+	return nil
+}
+
+// testConfig sets up to run a monitor on stats, reporting in CSV to
+// the returned buffer. Its netinfo knows about lo as a loopback.
+func testConfig(t *testing.T, stats ...Stats) (*config, *fakeSource, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	out = buf
+	outFormat = csvFormat{}
+	t.Cleanup(func() {
+		out = os.Stdout
+		outFormat = nil
+		onlyDevices = nil
+		devGroups = nil
+	})
+
+	clk := &fakeClock{t: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	src := &fakeSource{clock: clk, stats: stats}
+	cfg := newConfig()
+	cfg.netinfo.loopbacks.add("lo")
+	cfg.source = src
+	cfg.clock = clk
+	return cfg, src, buf
+}
+
+// csvRate is a device's RX and TX rates in one CSV row.
+type csvRate struct {
+	dev    string
+	rx, tx string
+}
+
+func csvRates(t *testing.T, buf *bytes.Buffer) []csvRate {
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("bad CSV output: %s", err)
+	}
+	var rates []csvRate
+	for _, r := range rows {
+		rates = append(rates, csvRate{r[1], r[4], r[5]})
+	}
+	return rates
+}
+
+func checkRates(t *testing.T, got, want []csvRate) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got rates %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report line %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProcessLoopDeltas(t *testing.T) {
+	cfg, src, buf := testConfig(t,
+		Stats{"eth0": {RBytes: 1000, TBytes: 500}, "lo": {RBytes: 100, TBytes: 100}, "eth1": {}},
+		Stats{"eth0": {RBytes: 3000, TBytes: 500}, "lo": {RBytes: 200, TBytes: 200}, "eth1": {}},
+		Stats{"eth0": {RBytes: 6000, TBytes: 1500}, "lo": {RBytes: 300, TBytes: 300}, "eth1": {}},
+	)
+	processLoop(cfg, nil, false, nil, false)
+
+	if src.fills != 3 {
+		t.Errorf("filled %d times, want 3", src.fills)
+	}
+	// Loopbacks and inactive devices are left out.
+	checkRates(t, csvRates(t, buf), []csvRate{
+		{"eth0", "2000", "0"},
+		{"eth0", "3000", "1000"},
+	})
+}
+
+func TestProcessLoopCount(t *testing.T) {
+	cfg, src, buf := testConfig(t,
+		Stats{"eth0": {RBytes: 1000}},
+		Stats{"eth0": {RBytes: 2000}},
+		Stats{"eth0": {RBytes: 3000}},
+		Stats{"eth0": {RBytes: 4000}},
+	)
+	cfg.reportCount = 2
+	processLoop(cfg, nil, false, nil, false)
+
+	if src.fills != 3 {
+		t.Errorf("filled %d times, want 3", src.fills)
+	}
+	checkRates(t, csvRates(t, buf), []csvRate{
+		{"eth0", "1000", "0"},
+		{"eth0", "1000", "0"},
+	})
+}
+
+func TestProcessLoopQuick(t *testing.T) {
+	cfg, src, buf := testConfig(t,
+		Stats{"eth0": {RBytes: 1000}},
+		Stats{"eth0": {RBytes: 1250}},
+		Stats{"eth0": {RBytes: 2250}},
+	)
+	cfg.quickSample = 250 * time.Millisecond
+	processLoop(cfg, nil, false, nil, false)
+
+	if src.fills != 3 {
+		t.Errorf("filled %d times, want 3", src.fills)
+	}
+	// Each fill moves the clock on by a second, so the quick
+	// sample covers that plus our sleep.
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("bad CSV output: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %v", len(rows), rows)
+	}
+	if rows[0][3] != "1.25" || rows[0][4] != "200" {
+		t.Errorf("quick sample: got interval %s and RX %s, want 1.25 and 200", rows[0][3], rows[0][4])
+	}
+	if rows[1][3] != "1" || rows[1][4] != "1000" {
+		t.Errorf("normal sample: got interval %s and RX %s, want 1 and 1000", rows[1][3], rows[1][4])
+	}
+}
+
+func TestProcessLoopCounterWrap(t *testing.T) {
+	cfg, _, buf := testConfig(t,
+		Stats{"eth0": {RBytes: 1<<32 - 1000, TBytes: 100}, "eth1": {RBytes: 5 << 32, TBytes: 100}},
+		Stats{"eth0": {RBytes: 1000, TBytes: 300}, "eth1": {RBytes: 100, TBytes: 200}},
+		Stats{"eth0": {RBytes: 2000, TBytes: 400}, "eth1": {RBytes: 600, TBytes: 300}},
+	)
+	processLoop(cfg, []string{"eth0", "eth1"}, false, nil, false)
+
+	// eth0's 32-bit counter wrapped, while eth1's counters were
+	// reset, so it's left out until we have a good interval.
+	checkRates(t, csvRates(t, buf), []csvRate{
+		{"eth0", "2000", "200"},
+		{"eth0", "1000", "100"},
+		{"eth1", "500", "100"},
+	})
+}
+
+func TestNewMonitor(t *testing.T) {
+	cfg, src, _ := testConfig(t,
+		Stats{"eth0": {RBytes: 1000}, "eth1": {RBytes: 1000}, "lo": {RBytes: 1000}},
+	)
+	m := newMonitor(cfg, []string{"eth*"}, []string{"eth1"}, false)
+	if src.fills != 1 {
+		t.Errorf("filled %d times, want 1", src.fills)
+	}
+	if len(m.keys) != 1 || m.keys[0] != "eth0" {
+		t.Errorf("watching %v, want [eth0]", m.keys)
+	}
+	// The run starts with our first stats.
+	if want := cfg.clock.now().Add(-time.Second); !runStart.Equal(want) {
+		t.Errorf("run started at %s, want %s", runStart, want)
+	}
+}
+
+func TestProcessLoopAliasIfindex(t *testing.T) {
+	cfg, _, buf := testConfig(t,
+		Stats{"eth0": {RBytes: 1000}, "eth1": {RBytes: 1000}},
+		Stats{"eth0": {RBytes: 2000}, "eth1": {RBytes: 3000}},
+	)
+	cfg.netinfo.ifindex["eth0"] = 2
+	cfg.netinfo.ifindex["eth1"] = 3
+	aliasArgs = aliasFlags{"eth1=uplink"}
+	t.Cleanup(func() {
+		aliasArgs = nil
+		devAliases = make(map[string]string)
+	})
+	processLoop(cfg, nil, false, nil, false)
+
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("bad CSV output: %s", err)
+	}
+	// Aliased devices are labeled with the alias but still have
+	// their real ifindex.
+	want := [][2]string{{"eth0", "2"}, {"uplink", "3"}}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		if rows[i][1] != w[0] || rows[i][2] != w[1] {
+			t.Errorf("row %d: got device %s ifindex %s, want %s %s", i, rows[i][1], rows[i][2], w[0], w[1])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//
+// Desktop notifications (-notify), for people who leave netvolmon
+// running in a background terminal and only want to hear from it when
+// something happens: a burst (-B), an alert (-alert) or a link
+// changing state (-linkstate). We use notify-send(1), which talks
+// D-Bus to whatever notification daemon the desktop has.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var desktopNotify bool
+
+// We don't want a busy device to bury someone in notifications, so
+// each device gets at most one of each kind every notifyQuiet.
+const notifyQuiet = time.Minute
+
+var lastNotified = make(map[string]time.Time)
+
+// notify raises a desktop notification of some kind about a device,
+// unless we've done so too recently. It doesn't wait for notify-send
+// to finish.
+func notify(devname, kind, summary, body string) {
+	now := time.Now()
+	key := devname + " " + kind
+	if now.Sub(lastNotified[key]) < notifyQuiet {
+		return
+	}
+	lastNotified[key] = now
+
+	cmd := exec.Command("notify-send", "-a", "netvolmon", summary, body)
+	if err := cmd.Start(); err != nil {
+		log.Printf("notify-send: %s", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// notifyBurst notifies about a microburst on a device.
+func notifyBurst(c *config, devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	notify(devname, "burst", fmt.Sprintf("netvolmon: burst on %s", devname),
+		fmt.Sprintf("RX %s, TX %s at %s",
+			strings.TrimSpace(c.fmtRate(float64(dt.RBytes)/persec)),
+			strings.TrimSpace(c.fmtRate(float64(dt.TBytes)/persec)),
+			dt.When.Format(HMS)))
+}
@@ -0,0 +1,63 @@
+//
+// The order we report devices in (-sort). By default it's by name,
+// but on machines with lots of devices you usually want the busiest
+// ones first, and perhaps only the top few of them (-top).
+//
+
+package main
+
+import (
+	"sort"
+)
+
+var sortBy = "name"
+
+// topN is how many devices we show each interval (-top), or zero for
+// all of them.
+var topN int
+
+var sortOrders = map[string]bool{"name": true, "rx": true, "tx": true, "total": true}
+
+// sortValue is what we sort a device's interval on, for orders other
+// than by name. Intervals can differ in length between devices (for
+// example after -quick), so it's a rate.
+func sortValue(order string, dt DevDelta) float64 {
+	var b uint64
+	switch order {
+	case "rx":
+		b = dt.RBytes
+	case "tx":
+		b = dt.TBytes
+	default:
+		b = dt.RBytes + dt.TBytes
+	}
+	return float64(b) / dt.Delta.Seconds()
+}
+
+// devLess reports whether device a sorts before device b in the
+// given order. Traffic orders put the busiest first, with ties in
+// name order.
+func devLess(order string, a, b string, da, db DevDelta) bool {
+	if order != "name" {
+		if va, vb := sortValue(order, da), sortValue(order, db); va != vb {
+			return va > vb
+		}
+	}
+	return a < b
+}
+
+// sortKeys returns keys sorted in our -sort order. Devices that
+// aren't in dt go at the end.
+func sortKeys(dt Deltas, keys []string) []string {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, iok := dt[sorted[i]]
+		dj, jok := dt[sorted[j]]
+		if iok != jok {
+			return iok
+		}
+		return devLess(sortBy, sorted[i], sorted[j], di, dj)
+	})
+	return sorted
+}
@@ -0,0 +1,277 @@
+//
+// Where our reports go. Normally this is standard output, but with
+// -o we write to a file instead, optionally rolling over to a new
+// file every hour or every day so that long captures wind up in
+// manageable chunks.
+//
+// We can also roll over when the file gets too big (-rotate-size),
+// logrotate style: the full file becomes '<file>.1' ('<file>.1.gz'
+// for .gz files), any '.1' becomes '.2' and so on, and we only keep
+// -rotate-keep of them. This only happens between reports, so a file
+// can go a bit over. With -tee, reports also go to standard output.
+//
+// -q is the other way around: nothing goes to standard output, and
+// only errors go to standard error. Reports still go to -o files and
+// everywhere else we send them.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// out is where all periodic reports are written.
+var out io.Writer = os.Stdout
+
+var quiet bool
+
+// notesOut is where notices about devices (resets, link changes) go.
+// They can't be mixed into JSON, CSV and so on or drawn over the TUI,
+// so then they go to standard error, unless we're being quiet.
+func notesOut() io.Writer {
+	if formatName == "text" && !tuiMode {
+		return out
+	}
+	if quiet {
+		return ioutil.Discard
+	}
+	return os.Stderr
+}
+
+// strftime expands a small subset of strftime()-style % escapes in
+// a file name pattern. We only support the ones that are actually
+// useful for naming files.
+func strftime(pat string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(pat); i++ {
+		if pat[i] != '%' || i+1 == len(pat) {
+			b.WriteByte(pat[i])
+			continue
+		}
+		i++
+		switch pat[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", t.Month())
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case '%':
+			b.WriteByte('%')
+		default:
+			// Unknown escapes are passed through untouched.
+			b.WriteByte('%')
+			b.WriteByte(pat[i])
+		}
+	}
+	return b.String()
+}
+
+// nextBoundary returns the start of the next rotation period after
+// t. Periods are aligned to local wall clock time, so daily files
+// start at local midnight.
+func nextBoundary(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	switch period {
+	case "hourly":
+		return time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+	case "daily":
+		return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	}
+	// No rotation: never.
+	return time.Time{}
+}
+
+// An outFile is an io.Writer that writes to a file named from a
+// strftime-style pattern, reopening a newly named file when the
+// current rotation period ends.
+//
+// Files are always opened for appending, so restarting netvolmon
+// with the same pattern doesn't clobber what was already captured.
+// If there's a header, it's written at the start of every new file.
+type outFile struct {
+	// We may be closed from a signal handler while a report is
+	// being written.
+	mu      sync.Mutex
+	pattern string
+	period  string
+	header  string
+	file    *os.File
+	gz      *gzip.Writer
+	next    time.Time
+
+	// For -rotate-size, how big the current file is (after
+	// compression), and what we're allowed.
+	size    *countWriter
+	maxSize uint64
+	keep    int
+
+	// -tee's other destination.
+	tee io.Writer
+}
+
+// A countWriter counts what goes through it.
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+var rotateSize string
+var rotateKeep int
+var teeOut bool
+
+func newOutFile(pattern, period, header string, maxSize uint64, keep int) (*outFile, error) {
+	if period != "" && !strings.Contains(pattern, "%") {
+		return nil, fmt.Errorf("rotating output needs a %%-pattern file name, not '%s'", pattern)
+	}
+	of := &outFile{pattern: pattern, period: period, header: header, maxSize: maxSize, keep: keep}
+	if err := of.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return of, nil
+}
+
+// open (re)opens the output file for the period that t falls in.
+func (of *outFile) open(t time.Time) error {
+	fname := strftime(of.pattern, t)
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	of.closeFile()
+	of.file = f
+	of.size = &countWriter{w: f}
+	if fi, err := f.Stat(); err == nil {
+		of.size.n = uint64(fi.Size())
+	}
+	if strings.HasSuffix(of.pattern, ".gz") {
+		of.gz = gzip.NewWriter(of.size)
+	}
+	of.next = nextBoundary(t, of.period)
+
+	if of.size.n == 0 && of.header != "" {
+		if of.gz != nil {
+			_, err = of.gz.Write([]byte(of.header))
+		} else {
+			_, err = of.size.Write([]byte(of.header))
+		}
+		return err
+	}
+	return nil
+}
+
+// rotatedName is the name of the nth old copy of fname.
+func rotatedName(fname string, n int) string {
+	if strings.HasSuffix(fname, ".gz") {
+		return strings.TrimSuffix(fname, ".gz") + "." + strconv.Itoa(n) + ".gz"
+	}
+	return fname + "." + strconv.Itoa(n)
+}
+
+// rotateBySize moves the current file out of the way and starts a
+// new one, if the current one is big enough.
+func (of *outFile) rotateBySize() error {
+	if of.maxSize == 0 || of.file == nil || of.size.n < of.maxSize {
+		return nil
+	}
+	fname := of.file.Name()
+	of.closeFile()
+	os.Remove(rotatedName(fname, of.keep))
+	for n := of.keep - 1; n >= 1; n-- {
+		os.Rename(rotatedName(fname, n), rotatedName(fname, n+1))
+	}
+	if err := os.Rename(fname, rotatedName(fname, 1)); err != nil {
+		return err
+	}
+	return of.open(time.Now())
+}
+
+func (of *outFile) Write(p []byte) (int, error) {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if of.file == nil {
+		return 0, os.ErrClosed
+	}
+	if now := time.Now(); !of.next.IsZero() && !now.Before(of.next) {
+		if err := of.open(now); err != nil {
+			return 0, err
+		}
+	}
+	if of.tee != nil {
+		of.tee.Write(p)
+	}
+	if of.gz != nil {
+		return of.gz.Write(p)
+	}
+	return of.size.Write(p)
+}
+
+// Flush pushes out any compressed data that gzip is holding on to,
+// so that a file being written is always readable up to the last
+// report even if we're killed. Since it's called after every report,
+// it's also where we rotate by size.
+func (of *outFile) Flush() error {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if of.gz != nil {
+		if err := of.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return of.rotateBySize()
+}
+
+// closeFile finishes off any compressed stream and closes the
+// current file, if there is one.
+func (of *outFile) closeFile() error {
+	if of.file == nil {
+		return nil
+	}
+	if of.gz != nil {
+		of.gz.Close()
+		of.gz = nil
+	}
+	err := of.file.Close()
+	of.file = nil
+	return err
+}
+
+// Close closes the current output file.
+func (of *outFile) Close() error {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	return of.closeFile()
+}
+
+// flushOut flushes our output if it needs flushing. It's called at
+// the end of every reporting interval.
+func flushOut() {
+	if f, ok := out.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Rate percentiles (-pct). Peaks only tell you so much about a bursty
+// link; what you often want to know is how busy it usually is and how
+// busy it is the worst 10% or 1% of the time. We keep a histogram of
+// each device's per-interval RX and TX rates, and when stopped print
+// their p50, p90, p99 and max. SIGUSR2 prints them so far, on standard
+// error, whether or not you asked for -pct.
+//
+// The histogram buckets are log-spaced, eight to each doubling, so a
+// percentile is only good to within about 9%, but a device costs a
+// few hundred counters at most however long we run.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+var showPercentiles bool
+
+// bucketsPerDouble is how finely we divide up rates.
+const bucketsPerDouble = 8
+
+// A rateHist is a histogram of rates in bytes/sec, by bucket. Bucket
+// 0 is everything under 1 byte/sec.
+type rateHist struct {
+	counts map[int]uint64
+	n      uint64
+	max    float64
+}
+
+func (h *rateHist) add(rate float64) {
+	if h.counts == nil {
+		h.counts = make(map[int]uint64)
+	}
+	b := 0
+	if rate >= 1 {
+		b = int(math.Log2(rate)*bucketsPerDouble) + 1
+	}
+	h.counts[b]++
+	h.n++
+	if rate > h.max {
+		h.max = rate
+	}
+}
+
+// percentile returns the rate that p (0 to 1) of the rates were at or
+// under, as the top of its bucket. It's never more than the maximum.
+func (h *rateHist) percentile(p float64) float64 {
+	want := uint64(math.Ceil(p * float64(h.n)))
+	var seen uint64
+	for _, b := range sortedKeys(h.counts) {
+		seen += h.counts[b]
+		if seen >= want {
+			if b == 0 {
+				return math.Min(1, h.max)
+			}
+			return math.Min(math.Exp2(float64(b)/bucketsPerDouble), h.max)
+		}
+	}
+	return h.max
+}
+
+type devHists struct {
+	rx, tx rateHist
+}
+
+// hists is updated by processLoop and read at exit and on SIGUSR2.
+var histsMu sync.Mutex
+var hists = make(map[string]*devHists)
+
+// notePercentiles adds a device's interval to its histograms.
+func notePercentiles(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	histsMu.Lock()
+	defer histsMu.Unlock()
+	dh, ok := hists[devname]
+	if !ok {
+		dh = &devHists{}
+		hists[devname] = dh
+	}
+	dh.rx.add(float64(dt.RBytes) / persec)
+	dh.tx.add(float64(dt.TBytes) / persec)
+}
+
+// printPercentiles writes out every device's rate percentiles.
+func printPercentiles(c *config, w io.Writer) {
+	histsMu.Lock()
+	defer histsMu.Unlock()
+
+	keys := sortedKeys(hists)
+	if len(keys) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\npercentiles over %s:\n", time.Since(sumStart).Round(time.Second))
+	for _, k := range keys {
+		dh := hists[k]
+		for i, h := range []*rateHist{&dh.rx, &dh.tx} {
+			name, dir := devLabel(k), "RX"
+			if i == 1 {
+				name, dir = "", "TX"
+			}
+			fmt.Fprintf(w, "%s %s p50 %s  p90 %s  p99 %s  max %s\n", fmtName(name), dir,
+				c.fmtRate(h.percentile(0.5)), c.fmtRate(h.percentile(0.9)),
+				c.fmtRate(h.percentile(0.99)), c.fmtRate(h.max))
+		}
+	}
+}
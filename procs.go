@@ -0,0 +1,167 @@
+//
+// Top talkers by process (-procs N). After each interval's devices,
+// we list the N processes whose TCP sockets moved the most data in
+// it. Only TCP can be done, since only TCP sockets keep byte counts,
+// and a socket's traffic in the interval it closes is lost. Sockets
+// we can't find an owner for (often because they're closing, or
+// they belong to another user and we're not root) are lumped together.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var procTop int
+
+var lastSocks map[uint32]sockBytes
+var lastSockTime time.Time
+
+type procTraffic struct {
+	pid    int
+	comm   string
+	tx, rx uint64
+}
+
+// startProcs takes the first sample of sockets, which also checks
+// that we can get them at all.
+func startProcs() error {
+	socks, err := tcpSockets()
+	if err != nil {
+		return err
+	}
+	lastSocks, lastSockTime = socks, time.Now()
+	return nil
+}
+
+// sampleProcs returns the per-process TCP traffic since the last
+// sample, busiest first, and how long that was.
+func sampleProcs() ([]procTraffic, time.Duration, error) {
+	socks, err := tcpSockets()
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	dur := now.Sub(lastSockTime)
+
+	moved := make(map[uint32]sockBytes)
+	for ino, sb := range socks {
+		old := lastSocks[ino]
+		if sb.tx < old.tx || sb.rx < old.rx {
+			// A new socket that reused an inode.
+			old = sockBytes{}
+		}
+		d := sockBytes{sb.tx - old.tx, sb.rx - old.rx}
+		if d.tx > 0 || d.rx > 0 {
+			moved[ino] = d
+		}
+	}
+	lastSocks, lastSockTime = socks, now
+
+	owners := socketOwners(moved)
+	byPid := make(map[int]*procTraffic)
+	for ino, d := range moved {
+		pid := owners[ino]
+		pt := byPid[pid]
+		if pt == nil {
+			pt = &procTraffic{pid: pid, comm: procComm(pid)}
+			byPid[pid] = pt
+		}
+		pt.tx += d.tx
+		pt.rx += d.rx
+	}
+	procs := make([]procTraffic, 0, len(byPid))
+	for _, pt := range byPid {
+		procs = append(procs, *pt)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		ti, tj := procs[i].tx+procs[i].rx, procs[j].tx+procs[j].rx
+		if ti != tj {
+			return ti > tj
+		}
+		return procs[i].pid < procs[j].pid
+	})
+	return procs, dur, nil
+}
+
+// socketOwners finds which process has each socket open, by going
+// through everyone's /proc/<pid>/fd. Sockets we can't find are left
+// out.
+func socketOwners(socks map[uint32]sockBytes) map[uint32]int {
+	owners := make(map[uint32]int)
+	if len(socks) == 0 {
+		return owners
+	}
+	pids, _ := ioutil.ReadDir("/proc")
+	for _, p := range pids {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fddir := filepath.Join("/proc", p.Name(), "fd")
+		fds, _ := ioutil.ReadDir(fddir)
+		for _, fd := range fds {
+			l, err := os.Readlink(filepath.Join(fddir, fd.Name()))
+			if err != nil || !strings.HasPrefix(l, "socket:[") {
+				continue
+			}
+			ino, err := strconv.ParseUint(l[len("socket:["):len(l)-1], 10, 32)
+			if err != nil {
+				continue
+			}
+			if _, ok := socks[uint32(ino)]; ok {
+				if _, seen := owners[uint32(ino)]; !seen {
+					owners[uint32(ino)] = pid
+				}
+			}
+		}
+		if len(owners) == len(socks) {
+			break
+		}
+	}
+	return owners
+}
+
+// procComm is a process's command name.
+func procComm(pid int) string {
+	if pid == 0 {
+		return "(unknown)"
+	}
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "?"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// printTopProcs prints this interval's top processes, indented
+// under the devices.
+func printTopProcs(c *config) {
+	procs, dur, err := sampleProcs()
+	if err != nil {
+		log.Print("-procs: ", err)
+		return
+	}
+	secs := dur.Seconds()
+	for i, pt := range procs {
+		if i >= procTop {
+			break
+		}
+		rx, tx := float64(pt.rx)/secs, float64(pt.tx)/secs
+		bwD, bwU := c.getBwDiv(rx + tx)
+		name := pt.comm
+		if pt.pid != 0 {
+			name = fmt.Sprintf("%s[%d]", pt.comm, pt.pid)
+		}
+		fmt.Fprintf(out, "   %-22s %6.2f RX %6.2f TX (%s)\n", name, rx/bwD, tx/bwD, bwU)
+	}
+}
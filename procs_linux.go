@@ -0,0 +1,126 @@
+//
+// Per-socket TCP byte counts on Linux, for -procs. A sock_diag dump
+// with INET_DIAG_INFO gives us each TCP socket's struct tcp_info,
+// which (since Linux 4.2) has how many bytes it has sent and received
+// in total, along with the socket's inode so we can find its owner.
+//
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	netlinkSockDiag   = 4
+	sockDiagByFamily  = 20
+	inetDiagInfo      = 2
+	inetDiagReqV2Len  = 56
+	inetDiagMsgLen    = 72
+	tcpiBytesAcked    = 120
+	tcpiBytesReceived = 128
+)
+
+// sock_diag answers in host byte order.
+var hostEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		hostEndian = binary.BigEndian
+	}
+}
+
+// sockBytes is a socket's total bytes sent and received so far.
+type sockBytes struct {
+	tx, rx uint64
+}
+
+// tcpSockets returns the byte counts of all TCP sockets, by inode.
+func tcpSockets() (map[uint32]sockBytes, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkSockDiag)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+	socks := make(map[uint32]sockBytes)
+	for _, fam := range []byte{syscall.AF_INET, syscall.AF_INET6} {
+		if err := dumpTCP(fd, fam, socks); err != nil {
+			return nil, err
+		}
+	}
+	return socks, nil
+}
+
+// dumpTCP asks for and reads one address family's TCP sockets.
+func dumpTCP(fd int, fam byte, socks map[uint32]sockBytes) error {
+	req := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqV2Len)
+	hostEndian.PutUint32(req[0:], uint32(len(req)))
+	hostEndian.PutUint16(req[4:], sockDiagByFamily)
+	hostEndian.PutUint16(req[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	hostEndian.PutUint32(req[8:], 1)
+	r := req[syscall.NLMSG_HDRLEN:]
+	r[0] = fam
+	r[1] = syscall.IPPROTO_TCP
+	r[2] = 1 << (inetDiagInfo - 1)
+	hostEndian.PutUint32(r[4:], 0xffffffff)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				return errors.New("sock_diag dump failed")
+			}
+			if len(m.Data) < inetDiagMsgLen {
+				continue
+			}
+			inode := hostEndian.Uint32(m.Data[68:])
+			if info := diagInfo(m.Data[inetDiagMsgLen:]); len(info) >= tcpiBytesReceived+8 && inode != 0 {
+				socks[inode] = sockBytes{
+					tx: hostEndian.Uint64(info[tcpiBytesAcked:]),
+					rx: hostEndian.Uint64(info[tcpiBytesReceived:]),
+				}
+			}
+		}
+	}
+}
+
+// diagInfo finds the INET_DIAG_INFO attribute among a message's
+// attributes.
+func diagInfo(b []byte) []byte {
+	for len(b) >= syscall.SizeofRtAttr {
+		alen := int(hostEndian.Uint16(b[0:]))
+		if alen < syscall.SizeofRtAttr || alen > len(b) {
+			return nil
+		}
+		if hostEndian.Uint16(b[2:]) == inetDiagInfo {
+			return b[syscall.SizeofRtAttr:alen]
+		}
+		alen = (alen + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if alen > len(b) {
+			return nil
+		}
+		b = b[alen:]
+	}
+	return nil
+}
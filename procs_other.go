@@ -0,0 +1,16 @@
+//
+// Only Linux will tell us how much each socket has sent and received.
+//
+
+//go:build !linux
+// +build !linux
+
+package main
+
+type sockBytes struct {
+	tx, rx uint64
+}
+
+func tcpSockets() (map[uint32]sockBytes, error) {
+	return nil, unsupported("-procs is only supported on Linux")
+}
@@ -0,0 +1,133 @@
+//
+// Prometheus exporter mode (-listen). Instead of printing reports, we
+// serve the most recent per-device rates and the raw counters behind
+// them on /metrics in the Prometheus text format. Which devices are
+// exported is decided the same way as which devices are reported on.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var listenAddr string
+
+// promDevice is what we export for a device.
+type promDevice struct {
+	rx, tx   float64 // bytes/sec
+	rxp, txp float64 // packets/sec
+	counters DevStat
+}
+
+var promMu sync.Mutex
+var promDevices = make(map[string]promDevice)
+
+// promUpdate is given one interval's deltas for the devices we're
+// exporting and replaces what we export with them. The raw counters
+// come from the latest stats snapshot.
+func promUpdate(dt Deltas, devs []string) {
+	lastMu.Lock()
+	st := lastStats
+	lastMu.Unlock()
+
+	nd := make(map[string]promDevice, len(devs))
+	for _, k := range devs {
+		v := dt[k]
+		persec := float64(v.Delta) / float64(time.Second)
+		nd[k] = promDevice{
+			rx:       float64(v.RBytes) / persec,
+			tx:       float64(v.TBytes) / persec,
+			rxp:      float64(v.RPackets) / persec,
+			txp:      float64(v.TPackets) / persec,
+			counters: st[k],
+		}
+	}
+	promMu.Lock()
+	promDevices = nd
+	promMu.Unlock()
+}
+
+// promEscape escapes a label value.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// promMetric writes out one metric family for all devices.
+func promMetric(w io.Writer, devs []string, name, mtype, help string, val func(pd promDevice) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, mtype)
+	for _, k := range devs {
+		fmt.Fprintf(w, "%s{device=\"%s\"} %g\n", name, promEscape(k), val(promDevices[k]))
+	}
+}
+
+func promHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	v, c := buildVersion()
+	fmt.Fprintf(w, "# HELP netvolmon_build_info Which netvolmon this is.\n# TYPE netvolmon_build_info gauge\n")
+	fmt.Fprintf(w, "netvolmon_build_info{version=\"%s\",commit=\"%s\",goversion=\"%s\"} 1\n",
+		promEscape(v), promEscape(c), runtime.Version())
+
+	promMu.Lock()
+	defer promMu.Unlock()
+	devs := sortedKeys(promDevices)
+
+	promMetric(w, devs, "netvolmon_receive_bytes_per_second", "gauge",
+		"Bytes received per second over the last interval.",
+		func(pd promDevice) float64 { return pd.rx })
+	promMetric(w, devs, "netvolmon_transmit_bytes_per_second", "gauge",
+		"Bytes transmitted per second over the last interval.",
+		func(pd promDevice) float64 { return pd.tx })
+	promMetric(w, devs, "netvolmon_receive_packets_per_second", "gauge",
+		"Packets received per second over the last interval.",
+		func(pd promDevice) float64 { return pd.rxp })
+	promMetric(w, devs, "netvolmon_transmit_packets_per_second", "gauge",
+		"Packets transmitted per second over the last interval.",
+		func(pd promDevice) float64 { return pd.txp })
+	promMetric(w, devs, "netvolmon_receive_bytes_total", "counter",
+		"Total bytes received.",
+		func(pd promDevice) float64 { return float64(pd.counters.RBytes) })
+	promMetric(w, devs, "netvolmon_transmit_bytes_total", "counter",
+		"Total bytes transmitted.",
+		func(pd promDevice) float64 { return float64(pd.counters.TBytes) })
+	promMetric(w, devs, "netvolmon_receive_packets_total", "counter",
+		"Total packets received.",
+		func(pd promDevice) float64 { return float64(pd.counters.RPackets) })
+	promMetric(w, devs, "netvolmon_transmit_packets_total", "counter",
+		"Total packets transmitted.",
+		func(pd promDevice) float64 { return float64(pd.counters.TPackets) })
+}
+
+// startExporter starts serving metrics on addr. We listen before
+// returning so that problems with the address are reported right
+// away.
+func startExporter(addr string) error {
+	l, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", promHandler)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		err := srv.Serve(l)
+		if err != http.ErrServerClosed {
+			fatalf("exporter stopped: %s", err)
+		}
+	}()
+	// Let any scrape in progress finish when we stop.
+	atExit(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return nil
+}
@@ -0,0 +1,95 @@
+//
+// Per-queue traffic for multiqueue NICs (-queues), for chasing RSS
+// and IRQ imbalance. Each device's line is followed by one for each
+// of its hardware queues, from the driver statistics (see ethtool_*.go).
+// Drivers name their per-queue counters in several ways; we know
+// 'rx_queue_0_bytes' (ixgbe, virtio and others), 'rx-0.bytes' (i40e),
+// 'rx0_bytes' (mlx5) and 'queue_0_rx_bytes' (ena). Devices whose
+// drivers don't have any of these just don't get queue lines.
+//
+// Queue counters are read when we report, which is a little after we
+// read the device's, so the two may not quite add up.
+//
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/siebenmann/netvolmon/netvol"
+)
+
+var showQueues bool
+
+var queueStatREs = []*regexp.Regexp{
+	regexp.MustCompile(`^(rx|tx)[-_]?(?:queue[-_])?(\d+)[._](bytes|packets)$`),
+	regexp.MustCompile(`^queue_(\d+)_(rx|tx)_(bytes|packets)$`),
+}
+
+// lastQueues are each device's queue counters as of last time.
+var lastQueues = make(map[string]map[int]DevStat)
+
+// queueStats returns a device's counters by queue.
+func queueStats(dev string) map[int]DevStat {
+	st, err := ethtoolStats(dev)
+	if err != nil {
+		return nil
+	}
+	when := time.Now()
+	qs := make(map[int]DevStat)
+	for name, v := range st {
+		var dir, num, what string
+		if m := queueStatREs[0].FindStringSubmatch(name); m != nil {
+			dir, num, what = m[1], m[2], m[3]
+		} else if m := queueStatREs[1].FindStringSubmatch(name); m != nil {
+			dir, num, what = m[2], m[1], m[3]
+		} else {
+			continue
+		}
+		q, _ := strconv.Atoi(num)
+		ds := qs[q]
+		ds.When = when
+		switch dir + what {
+		case "rxbytes":
+			ds.RBytes = v
+		case "rxpackets":
+			ds.RPackets = v
+		case "txbytes":
+			ds.TBytes = v
+		case "txpackets":
+			ds.TPackets = v
+		}
+		qs[q] = ds
+	}
+	return qs
+}
+
+// reportQueues reports a device's queues for this interval, indented
+// under it.
+func reportQueues(c *config, dev string, quick bool) {
+	qs := queueStats(dev)
+	old := lastQueues[dev]
+	lastQueues[dev] = qs
+	if old == nil {
+		return
+	}
+	nums := make([]int, 0, len(qs))
+	for q := range qs {
+		nums = append(nums, q)
+	}
+	sort.Ints(nums)
+	for _, q := range nums {
+		o, ok := old[q]
+		if !ok {
+			continue
+		}
+		n := qs[q]
+		if d, good := netvol.Delta(&o, &n); good && d.Delta > 0 {
+			outFormat.device(c, fmt.Sprintf("%s:q%d", dev, q), d, lineExtras{quick: quick, master: dev})
+		}
+	}
+}
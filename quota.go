@@ -0,0 +1,172 @@
+//
+// Byte quota tracking (-quota), for metered links. We count every
+// device's RX plus TX bytes over a quota period (a day, a week or a
+// month), show how much of the quota has been used, and project when
+// it will run out at the rate it's being used so far this period.
+//
+// With -quota-state, usage is saved to a file so that it survives
+// restarts; otherwise we only know about what we've seen ourselves.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var quotaSize string
+var quotaPeriod string
+var quotaStateFile string
+
+// quotaBytes is the parsed -quota.
+var quotaBytes uint64
+
+// quotaUse is a device's usage in the current quota period.
+type quotaUse struct {
+	Period time.Time `json:"period"` // start of the period
+	Since  time.Time `json:"since"`  // when we started counting
+	Bytes  uint64    `json:"bytes"`
+}
+
+var quotas = make(map[string]*quotaUse)
+
+// How often we save quota state, in addition to when we stop.
+const quotaSaveEvery = time.Minute
+
+var quotaSaved time.Time
+
+// parseSize parses sizes like '500G' or '1TB'. As elsewhere, a K is
+// 1024. Zero is a fine size; callers that can't use it check.
+func parseSize(s string) (uint64, error) {
+	mult := uint64(1)
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	if len(num) > 0 {
+		switch num[len(num)-1] {
+		case 'K':
+			mult = kB
+		case 'M':
+			mult = mB
+		case 'G':
+			mult = gB
+		case 'T':
+			mult = gB * 1024
+		}
+		if mult != 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size '%s'", s)
+	}
+	return uint64(n * float64(mult)), nil
+}
+
+// periodStart returns the start of the quota period that t is in.
+// Weeks start on Monday.
+func periodStart(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	switch period {
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case "week":
+		wd := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-wd, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// periodEnd returns the end of the quota period starting at start.
+func periodEnd(start time.Time, period string) time.Time {
+	switch period {
+	case "day":
+		return start.AddDate(0, 0, 1)
+	case "week":
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// noteQuota adds a device's interval to its quota usage, starting a
+// new period if necessary.
+func noteQuota(devname string, dt DevDelta) {
+	ps := periodStart(dt.When, quotaPeriod)
+	qu, ok := quotas[devname]
+	if !ok || !qu.Period.Equal(ps) {
+		qu = &quotaUse{Period: ps, Since: dt.When.Add(-dt.Delta)}
+		if qu.Since.Before(ps) {
+			qu.Since = ps
+		}
+		quotas[devname] = qu
+	}
+	qu.Bytes += dt.RBytes + dt.TBytes
+
+	if quotaStateFile != "" && time.Since(quotaSaved) >= quotaSaveEvery {
+		saveQuotas()
+	}
+}
+
+// quotaStatus returns a short description of a device's quota usage
+// and, if it's on track to run out this period, when.
+func quotaStatus(devname string) string {
+	qu, ok := quotas[devname]
+	if !ok {
+		return ""
+	}
+	pct := float64(qu.Bytes) * 100 / float64(quotaBytes)
+	if qu.Bytes >= quotaBytes {
+		return fmt.Sprintf("quota %.1f%% used, exhausted", pct)
+	}
+
+	now := time.Now()
+	end := periodEnd(qu.Period, quotaPeriod)
+	elapsed := now.Sub(qu.Since).Seconds()
+	if elapsed <= 0 || qu.Bytes == 0 {
+		return fmt.Sprintf("quota %.1f%% used", pct)
+	}
+	rate := float64(qu.Bytes) / elapsed
+	left := float64(quotaBytes-qu.Bytes) / rate
+	out := now.Add(time.Duration(left * float64(time.Second)))
+	if left > float64(1<<62)/float64(time.Second) || out.After(end) {
+		return fmt.Sprintf("quota %.1f%% used", pct)
+	}
+	return fmt.Sprintf("quota %.1f%% used, runs out %s", pct, out.Format("Jan 2 15:04"))
+}
+
+// loadQuotas loads saved quota usage, if there is any.
+func loadQuotas() error {
+	data, err := ioutil.ReadFile(quotaStateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &quotas)
+}
+
+// saveQuotas saves our quota usage. Failures are reported but not
+// fatal; we'll try again later.
+func saveQuotas() {
+	quotaSaved = time.Now()
+	data, err := json.Marshal(quotas)
+	if err == nil {
+		tmp := quotaStateFile + ".new"
+		err = ioutil.WriteFile(tmp, data, 0644)
+		if err == nil {
+			err = os.Rename(tmp, quotaStateFile)
+		}
+	}
+	if err != nil {
+		log.Print("error saving quota state: ", err)
+	}
+}
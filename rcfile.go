@@ -0,0 +1,131 @@
+//
+// Default options from a config file, ~/.netvolmonrc or (if that
+// doesn't exist) ~/.config/netvolmon/config. It has one option per
+// line, written as on the command line but with the dash optional:
+//
+//	# always in KB/s with timestamps
+//	k
+//	T
+//	d 5s
+//	x docker0,virbr0
+//
+// The file's options are only defaults. We read it after the command
+// line, and skip any option that the command line already set, or
+// that clashes with one it set, so that 'a' in the file doesn't stop
+// you from using -k and 'd 5s' doesn't stop 'netvolmon eth0 10'. Nor
+// does anything in the file count as conflicting with -L, -W or -R.
+//
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rcExclusive are sets of options that can't be used together (or
+// that mean the same thing). If the command line uses any of a set,
+// we skip all of them in the file.
+var rcExclusive = [][]string{
+	{"k", "a", "m", "g", "A"},
+	{"j", "json", "csv", "influx", "format"},
+	{"layout", "wide", "narrow"},
+	{"q", "S", "screen", "tui"},
+	{"q", "tee"},
+	{"q", "bell"},
+	{"1", "c"},
+	{"1", "quick"},
+	{"1", "S", "screen", "tui"},
+	{"1", "listen"},
+}
+
+// rcFileName returns the config file we should read, or "" if there
+// isn't one.
+func rcFileName() string {
+	var cands []string
+	if home, err := os.UserHomeDir(); err == nil {
+		cands = append(cands, filepath.Join(home, ".netvolmonrc"))
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		cands = append(cands, filepath.Join(dir, "netvolmon", "config"))
+	}
+	for _, c := range cands {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// loadRCFile sets flags from a config file, skipping the ones that
+// skip says to.
+func loadRCFile(fname string, skip func(string) bool) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	lnum := 0
+	for sc.Scan() {
+		lnum++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, val := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			name, val = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		name = strings.TrimLeft(name, "-")
+		fl := flag.Lookup(name)
+		if fl == nil {
+			return fmt.Errorf("%s:%d: no such option '%s'", fname, lnum, name)
+		}
+		if val == "" {
+			if bf, ok := fl.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+				val = "true"
+			} else {
+				return fmt.Errorf("%s:%d: option '%s' needs a value", fname, lnum, name)
+			}
+		}
+		if skip(name) {
+			continue
+		}
+		if err := flag.Set(name, val); err != nil {
+			return fmt.Errorf("%s:%d: %s: %s", fname, lnum, name, err)
+		}
+	}
+	return sc.Err()
+}
+
+// rcSkipper says which of the file's options the command line
+// overrides, given whether it ended with a number of seconds (which
+// is -d).
+func rcSkipper(trailingSecs bool) func(string) bool {
+	onCmdline := make(set[string])
+	flag.Visit(func(f *flag.Flag) { onCmdline.add(f.Name) })
+	if trailingSecs {
+		onCmdline.add("d")
+	}
+	skip := make(set[string])
+	skip.addlist(onCmdline.members())
+	for _, excl := range rcExclusive {
+		for _, n := range excl {
+			if onCmdline.isin(n) {
+				skip.addlist(excl)
+				break
+			}
+		}
+	}
+	return skip.isin
+}
@@ -0,0 +1,49 @@
+//
+// Recording raw stats snapshots to a file while we report (-record),
+// so that a problem can be captured and looked at again later. Each
+// snapshot is appended as a line of JSON, in the same form as the
+// stats in a -state file:
+//
+//	{"time":"...","stats":{"eth0":{"When":"...","RBytes":...,...},...}}
+//
+// With explicit devices, only they (and group members) are recorded.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+var recordFile string
+var recordOut *os.File
+
+type recordedStats struct {
+	Time  time.Time `json:"time"`
+	Stats Stats     `json:"stats"`
+}
+
+func openRecord(fname string) error {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	recordOut = f
+	atExit(func() { f.Close() })
+	return nil
+}
+
+// recordStats appends a snapshot. Write errors are logged but we carry
+// on, since the report is still useful.
+func recordStats(st Stats) {
+	b, err := json.Marshal(&recordedStats{Time: time.Now(), Stats: st})
+	if err == nil {
+		_, err = recordOut.Write(append(b, '\n'))
+	}
+	if err != nil {
+		log.Print("error recording stats: ", err)
+	}
+}
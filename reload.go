@@ -0,0 +1,82 @@
+//
+// Taking a fresh look at the network devices on SIGHUP. Normally we
+// only find out what devices there are, which are loopbacks and
+// point to point devices, and what IPs they have when we start, which
+// is wrong for a long-running netvolmon on a machine where VPN and
+// other PtP devices come and go or IPs move around. On SIGHUP we do
+// it all again and re-expand the device specifiers we were given
+// (including -x's, -P and -group's), as if we were starting.
+//
+// For stats from elsewhere, there's no network information of ours to
+// reload, but the device specifiers are still re-expanded. Replays
+// have nothing new to find.
+//
+// With -rescan, we also do this every so often by ourselves. We only
+// mention those reloads if they change the devices we're watching.
+//
+// If something goes wrong, such as a device specifier no longer
+// matching anything, we complain and carry on as we were.
+//
+
+package main
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var rescanEvery time.Duration
+
+// startRescans asks for a reload every -rescan.
+func startRescans() {
+	go func() {
+		for range time.Tick(rescanEvery) {
+			atomic.CompareAndSwapInt32(&reloadWanted, 0, reloadRescan)
+		}
+	}()
+}
+
+// ownStats is whether our stats are this machine's.
+func ownStats() bool {
+	return snmpHost == "" && replayFile == "" && remoteHost == "" && connectAddr == ""
+}
+
+// maybeReload reloads if we've been asked to, updating the keys and
+// excluder to use from now on.
+func (m *monitor) maybeReload() {
+	why := atomic.SwapInt32(&reloadWanted, 0)
+	if why == 0 || replayFile != "" {
+		return
+	}
+	if ownStats() {
+		ni := newNetinfo()
+		if err := setupNetinfo(ni); err != nil {
+			log.Print("reload: error on network info setup: ", err)
+			return
+		}
+		m.cfg.netinfo = ni
+	}
+
+	st := make(Stats)
+	if err := m.cfg.source.fill(st, nil); err != nil {
+		log.Print("reload: error filling: ", err)
+		return
+	}
+	excludes := makeExcluder(m.cfg, m.exlist, m.noPtP)
+	keys, err := chooseDevices(m.cfg, m.devices, st, excludes)
+	if err != nil {
+		log.Print("reload: ", err)
+		return
+	}
+	was, now := strings.Join(m.keys, " "), strings.Join(keys, " ")
+	switch {
+	case quiet:
+	case len(m.devices) > 0 && (why == reloadSignal || was != now):
+		log.Printf("reloaded; watching %s", now)
+	case why == reloadSignal:
+		log.Print("reloaded")
+	}
+	m.keys, m.excludes = keys, excludes
+}
@@ -0,0 +1,266 @@
+//
+// Watching other machines' devices. With -remote user@host, we start
+// 'netvolmon dump' on it with ssh and keep that running; with -connect
+// host:port, we talk to a 'netvolmon -serve host:port' running there.
+// Either way, each time we want stats we send a newline and get back
+// a dump of its devices' counters, one per line, then a blank line:
+//
+//	<device> <rx bytes> <tx bytes> <rx packets> <tx packets> [loopback]
+//
+// For -remote, the remote end needs netvolmon installed (-remote-cmd
+// if it's not on the $PATH as 'netvolmon'), but nothing else, and ssh
+// needs to be able to log in without asking for a password. -serve has
+// no authentication at all, so only listen where you trust everyone.
+//
+// Both take a comma-separated list, and can be used together. With
+// more than one machine, devices are named '<host>:<device>', so you
+// can ask for 'web1:eth0 web2:eth0' or '*:eth0'. If two sources are on
+// the same host, their devices are named with the whole source
+// instead, eg 'web1:7000:eth0'.
+//
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var remoteHost string
+var remoteCmd string
+var serveAddr, connectAddr string
+
+// runDump is the 'dump' subcommand, the remote end of -remote.
+func runDump() {
+	if err := serveDump(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "netvolmon dump:", err)
+		os.Exit(exitCode(err, exitCollection))
+	}
+}
+
+// dumpMu keeps -serve's connections from gathering stats at once.
+var dumpMu sync.Mutex
+
+// serveDump answers dump requests from r on w until r runs out.
+func serveDump(r io.Reader, wr io.Writer) error {
+	loops := make(set[string])
+	if ints, err := net.Interfaces(); err == nil {
+		for _, i := range ints {
+			if i.Flags&net.FlagLoopback != 0 {
+				loops.add(i.Name)
+			}
+		}
+	}
+	in := bufio.NewReader(r)
+	w := bufio.NewWriter(wr)
+	for {
+		if _, err := in.ReadString('\n'); err != nil {
+			return nil
+		}
+		st := make(Stats)
+		dumpMu.Lock()
+		err := st.FillDevices(nil)
+		dumpMu.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, dev := range st.Members() {
+			v := st[dev]
+			fmt.Fprintf(w, "%s %d %d %d %d", dev, v.RBytes, v.TBytes, v.RPackets, v.TPackets)
+			if loops.isin(dev) {
+				fmt.Fprint(w, " loopback")
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// serveStats is -serve. It never returns unless it fails.
+func serveStats(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := serveDump(c, c); err != nil {
+				log.Printf("%s: %s", c.RemoteAddr(), err)
+			}
+			c.Close()
+		}()
+	}
+}
+
+// remoteSource is one machine we're getting stats from. With more
+// than one, their devices are called '<host>:<device>'.
+type remoteSource struct {
+	prefix string
+	in     io.WriteCloser
+	out    *bufio.Reader
+}
+
+var remotes []*remoteSource
+
+// setupRemotes starts all of our -remote and -connect sources, takes
+// a first look at their devices for netinfo, and makes them our
+// source of stats.
+func setupRemotes(ni *netInfo) error {
+	var hosts, addrs []string
+	if remoteHost != "" {
+		hosts = strings.Split(remoteHost, ",")
+	}
+	if connectAddr != "" {
+		addrs = strings.Split(connectAddr, ",")
+	}
+	// Devices are normally prefixed with their source's host, but
+	// sources on the same host need telling apart, so all of them
+	// get their whole spec instead.
+	specHost := make(map[string]string)
+	hostCount := make(map[string]int)
+	for _, spec := range append(hosts[:len(hosts):len(hosts)], addrs...) {
+		if _, ok := specHost[spec]; ok {
+			return fmt.Errorf("%s is given more than once", spec)
+		}
+		host := spec[strings.IndexByte(spec, '@')+1:]
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		specHost[spec] = host
+	}
+	for _, host := range specHost {
+		hostCount[host]++
+	}
+	prefix := func(spec string) string {
+		switch {
+		case len(specHost) == 1:
+			return ""
+		case hostCount[specHost[spec]] > 1:
+			return spec + ":"
+		}
+		return specHost[spec] + ":"
+	}
+
+	for _, h := range hosts {
+		rs, err := startSSH(h)
+		if err != nil {
+			return fmt.Errorf("%s: %s", h, err)
+		}
+		rs.prefix = prefix(h)
+		remotes = append(remotes, rs)
+	}
+	for _, a := range addrs {
+		conn, err := net.Dial("tcp", a)
+		if err != nil {
+			return err
+		}
+		atExit(func() { conn.Close() })
+		remotes = append(remotes, &remoteSource{prefix(a), conn, bufio.NewReader(conn)})
+	}
+
+	loops, err := readRemotes(make(Stats))
+	if err != nil {
+		return err
+	}
+	ni.loopbacks.addlist(loops)
+	fillStats = fillRemote
+	return nil
+}
+
+// startSSH starts a remote dump over ssh.
+func startSSH(host string) (*remoteSource, error) {
+	cmd := exec.Command("ssh", "-T", host, remoteCmd+" dump")
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	atExit(func() {
+		in.Close()
+		cmd.Wait()
+	})
+	return &remoteSource{in: in, out: bufio.NewReader(stdout)}, nil
+}
+
+// readRemotes gets a dump from every source, returning the loopbacks.
+// We ask them all first so that they gather their stats together.
+func readRemotes(s Stats) ([]string, error) {
+	for _, rs := range remotes {
+		if _, err := io.WriteString(rs.in, "\n"); err != nil {
+			return nil, err
+		}
+	}
+	var loops []string
+	for _, rs := range remotes {
+		l, err := rs.read(s)
+		if err != nil {
+			return nil, err
+		}
+		loops = append(loops, l...)
+	}
+	return loops, nil
+}
+
+// read reads one dump, returning the loopbacks.
+func (rs *remoteSource) read(s Stats) ([]string, error) {
+	var loops []string
+	var when time.Time
+	for {
+		line, err := rs.out.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("remote netvolmon went away")
+		}
+		if when.IsZero() {
+			when = time.Now()
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			break
+		}
+		if len(f) < 5 {
+			return nil, fmt.Errorf("bad line from remote: %q", line)
+		}
+		var n [4]uint64
+		for i := range n {
+			if n[i], err = strconv.ParseUint(f[i+1], 10, 64); err != nil {
+				return nil, fmt.Errorf("bad line from remote: %q", line)
+			}
+		}
+		dev := rs.prefix + f[0]
+		s[dev] = DevStat{When: when, RBytes: n[0], TBytes: n[1], RPackets: n[2], TPackets: n[3]}
+		if len(f) > 5 && f[5] == "loopback" {
+			loops = append(loops, dev)
+		}
+	}
+	return loops, nil
+}
+
+// fillRemote is our fillStats. It always gets every device.
+func fillRemote(s Stats, devs []string) error {
+	_, err := readRemotes(s)
+	return err
+}
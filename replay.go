@@ -0,0 +1,154 @@
+//
+// Replaying recorded stats (-replay), so that a captured problem can
+// be looked at again with different units, devices, sorting and so
+// on. The snapshots go through the same deltas and reports as live
+// ones, paced by the times they were taken at; -replay-speed speeds
+// that up (or, at 0, doesn't wait at all). Intervals are whatever
+// they were when recording, whatever -d says.
+//
+// We can replay:
+//   - a -record file.
+//   - a directory of copies of /proc/net/dev, taken in order of
+//     their names. A file named with a Unix time (perhaps with an
+//     extension) was taken then; otherwise we go by its mtime.
+//   - sysstat's 'sadf -j -- -n DEV' JSON output (see sadf.go).
+//
+// None of these say what were loopbacks, so we guess by name.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var replayFile string
+var replaySpeed float64
+
+// replayNext returns the next snapshot and when it was taken, or
+// errReplayDone when there are no more.
+var replayNext func() (Stats, time.Time, error)
+var replayLast time.Time
+
+// errReplayDone is what fillReplay returns at the end of the file.
+var errReplayDone = errors.New("end of replay")
+
+func setupReplay(ni *netInfo) error {
+	fi, err := os.Stat(replayFile)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = setupProcDirReplay(replayFile)
+	} else {
+		err = setupFileReplay(replayFile)
+	}
+	if err != nil {
+		return err
+	}
+	ni.loopbacks.addlist([]string{"lo", "lo0"})
+	fillStats = fillReplay
+	return nil
+}
+
+// setupFileReplay replays a -record file or sadf JSON.
+func setupFileReplay(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	atExit(func() { f.Close() })
+	br := bufio.NewReaderSize(f, 64*1024)
+	// Peek only errors if the file is shorter than this, which is
+	// fine.
+	start, _ := br.Peek(4096)
+	if bytes.Contains(start, []byte(`"sysstat"`)) {
+		return setupSadfReplay(br)
+	}
+
+	sc := bufio.NewScanner(br)
+	// Snapshots of machines with a lot of devices are long lines.
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lnum := 0
+	replayNext = func() (Stats, time.Time, error) {
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return nil, time.Time{}, err
+			}
+			return nil, time.Time{}, errReplayDone
+		}
+		lnum++
+		var rec recordedStats
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s:%d: %s", fname, lnum, err)
+		}
+		return rec.Stats, rec.Time, nil
+	}
+	return nil
+}
+
+// setupProcDirReplay replays a directory of /proc/net/dev copies.
+func setupProcDirReplay(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []os.FileInfo
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() {
+			files = append(files, fi)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	replayNext = func() (Stats, time.Time, error) {
+		if len(files) == 0 {
+			return nil, time.Time{}, errReplayDone
+		}
+		fi := files[0]
+		files = files[1:]
+		fname := filepath.Join(dir, fi.Name())
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		when := fi.ModTime()
+		base := strings.SplitN(fi.Name(), ".", 2)[0]
+		if secs, err := strconv.ParseInt(base, 10, 64); err == nil {
+			when = time.Unix(secs, 0)
+		}
+		st := make(Stats)
+		if err := st.ParseProcNetDev(data, when); err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s: %s", fname, err)
+		}
+		return st, when, nil
+	}
+	return nil
+}
+
+// fillReplay is our fillStats, giving the next snapshot once it's
+// time for it.
+func fillReplay(s Stats, devs []string) error {
+	st, when, err := replayNext()
+	if err != nil {
+		return err
+	}
+	if !replayLast.IsZero() && replaySpeed > 0 {
+		time.Sleep(time.Duration(float64(when.Sub(replayLast)) / replaySpeed))
+	}
+	replayLast = when
+	for k, v := range st {
+		s[k] = v
+	}
+	return nil
+}
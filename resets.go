@@ -0,0 +1,56 @@
+//
+// Explaining gaps (-resets). When a device's counters go backwards,
+// usually because it was destroyed and recreated under the same name,
+// we have no interval for it and it just goes missing from that
+// report. With -resets we say why, like -linkstate does for links:
+//
+//	14:02:07 eth0: counters reset
+//
+// With JSON, CSV or line protocol output this goes to standard error.
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/siebenmann/netvolmon/netvol"
+)
+
+var showResets bool
+
+// pendingResets are the devices to report as reset in the next
+// report, and resetWhen is when we noticed.
+var pendingResets []string
+var resetWhen time.Time
+
+// noteResets finds the devices we're watching whose counters were
+// reset between two stats.
+func noteResets(c *config, oldst, newst Stats, explicit bool, keys []string, excludes *excluder) {
+	pendingResets = nil
+	if !showResets {
+		return
+	}
+	watched := make(set[string])
+	watched.addlist(keys)
+	for _, dev := range netvol.Resets(oldst, newst) {
+		switch {
+		case explicit && !watched.isin(dev):
+		case !c.incLo && c.netinfo.loopbacks.isin(dev):
+		case excludes.isin(dev):
+		default:
+			pendingResets = append(pendingResets, dev)
+			resetWhen = newst[dev].When
+		}
+	}
+}
+
+// reportResets reports the pending resets.
+func reportResets() {
+	w := notesOut()
+	for _, dev := range pendingResets {
+		fmt.Fprintf(w, "%s %s: counters reset\n", stamp(resetWhen), devLabel(dev))
+	}
+	pendingResets = nil
+}
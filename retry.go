@@ -0,0 +1,55 @@
+//
+// Riding out errors getting stats. A momentary kstat failure or an
+// EINTR shouldn't kill a monitor that's been running for weeks, so
+// once we're going we retry a refill that fails, backing off from a
+// tenth of a second up to the report interval, and only give up after
+// -max-errors failures in a row. Errors that won't go away by
+// themselves, like not being allowed to get the stats at all, aren't
+// retried, and neither are replays, where trying again would just
+// skip ahead.
+//
+
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var maxErrors int
+
+// errStopped is refillStats giving up because we're stopping.
+var errStopped = errors.New("stopped while retrying")
+
+// refillStats gets fresh stats for devs from src, retrying as
+// necessary.
+func refillStats(src statsSource, devs []string) (Stats, error) {
+	delay := 100 * time.Millisecond
+	for tries := 1; ; tries++ {
+		st := make(Stats)
+		err := src.fill(st, devs)
+		if err == nil {
+			if tries > 1 && !quiet {
+				log.Printf("refilling worked again after %d errors", tries-1)
+			}
+			return st, nil
+		}
+		if err == errReplayDone || replayFile != "" || exitCode(err, 0) != 0 {
+			return nil, err
+		}
+		if maxErrors > 0 && tries >= maxErrors {
+			return nil, err
+		}
+		log.Printf("error refilling: %s; trying again in %s", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-stopping:
+			return nil, errStopped
+		}
+		delay *= 2
+		if delay > duration {
+			delay = duration
+		}
+	}
+}
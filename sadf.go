@@ -0,0 +1,114 @@
+//
+// Replaying sysstat's network device history, from the JSON that
+// 'sadf -j /var/log/sa/saNN -- -n DEV' prints. sar only keeps average
+// rates for each of its intervals, not counters, so we make up counters
+// that start from zero and go up by each interval's rate times its
+// length. The rates we report then come out as sar's.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+type sadfJSON struct {
+	Sysstat struct {
+		Hosts []struct {
+			Statistics []struct {
+				Timestamp struct {
+					Date     string `json:"date"`
+					Time     string `json:"time"`
+					UTC      int    `json:"utc"`
+					Interval int    `json:"interval"`
+				} `json:"timestamp"`
+				Network struct {
+					NetDev []struct {
+						Iface string  `json:"iface"`
+						RxPck float64 `json:"rxpck"`
+						TxPck float64 `json:"txpck"`
+						RxKB  float64 `json:"rxkB"`
+						TxKB  float64 `json:"txkB"`
+					} `json:"net-dev"`
+				} `json:"network"`
+			} `json:"statistics"`
+		} `json:"hosts"`
+	} `json:"sysstat"`
+}
+
+// setupSadfReplay reads all of the sadf output and turns it into
+// snapshots.
+func setupSadfReplay(r io.Reader) error {
+	var sj sadfJSON
+	if err := json.NewDecoder(r).Decode(&sj); err != nil {
+		return err
+	}
+	if len(sj.Sysstat.Hosts) == 0 {
+		return errors.New("no hosts in sadf output")
+	}
+
+	var snaps []Stats
+	var times []time.Time
+	counts := make(map[string]*[4]float64)
+	for _, st := range sj.Sysstat.Hosts[0].Statistics {
+		if len(st.Network.NetDev) == 0 {
+			continue
+		}
+		loc := time.Local
+		if st.Timestamp.UTC != 0 {
+			loc = time.UTC
+		}
+		when, err := time.ParseInLocation("2006-01-02 15:04:05", st.Timestamp.Date+" "+st.Timestamp.Time, loc)
+		if err != nil {
+			return err
+		}
+		ivl := float64(st.Timestamp.Interval)
+		// The first interval needs somewhere to start from.
+		if len(snaps) == 0 {
+			start := make(Stats)
+			for _, nd := range st.Network.NetDev {
+				start[nd.Iface] = DevStat{When: when.Add(-time.Duration(ivl) * time.Second)}
+			}
+			snaps = append(snaps, start)
+			times = append(times, when.Add(-time.Duration(ivl)*time.Second))
+		}
+		snap := make(Stats)
+		for _, nd := range st.Network.NetDev {
+			c := counts[nd.Iface]
+			if c == nil {
+				c = new([4]float64)
+				counts[nd.Iface] = c
+			}
+			c[0] += nd.RxKB * 1024 * ivl
+			c[1] += nd.TxKB * 1024 * ivl
+			c[2] += nd.RxPck * ivl
+			c[3] += nd.TxPck * ivl
+			snap[nd.Iface] = DevStat{
+				When:     when,
+				RBytes:   uint64(math.Round(c[0])),
+				TBytes:   uint64(math.Round(c[1])),
+				RPackets: uint64(math.Round(c[2])),
+				TPackets: uint64(math.Round(c[3])),
+			}
+		}
+		snaps = append(snaps, snap)
+		times = append(times, when)
+	}
+	if len(snaps) == 0 {
+		return errors.New("no network device statistics in sadf output")
+	}
+
+	replayNext = func() (Stats, time.Time, error) {
+		if len(snaps) == 0 {
+			return nil, time.Time{}, errReplayDone
+		}
+		st, when := snaps[0], times[0]
+		snaps, times = snaps[1:], times[1:]
+		return st, when, nil
+	}
+	return nil
+}
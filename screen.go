@@ -0,0 +1,28 @@
+//
+// Full-screen refresh mode (-S), where we redraw a single table in
+// place each interval instead of scrolling, a bit like watch(1). We
+// just use the standard ANSI escape sequences, which every terminal
+// anyone uses these days understands.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+var screenMode bool
+
+const (
+	ansiHome  = "\033[H"
+	ansiClear = "\033[2J"
+)
+
+// screenStart clears the screen and writes our title line at the
+// start of an interval's report.
+func screenStart(w io.Writer, when time.Time) {
+	fmt.Fprint(w, ansiHome+ansiClear)
+	fmt.Fprintf(w, "netvolmon: every %s   %s\n\n", duration, when.Format(HMS))
+}
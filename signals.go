@@ -0,0 +1,87 @@
+//
+// Signal handling. We normally run until someone interrupts us, so
+// things that need to happen at the end of a run (summaries, closing
+// output files properly) are hung off SIGINT and SIGTERM. SIGHUP
+// asks us to take a fresh look at the network devices (see reload.go).
+//
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var exitMu sync.Mutex
+var exitFuncs []func()
+
+// atExit registers a function to be called when we're interrupted or
+// terminated. Functions are called in the reverse order from how they
+// were registered, so things registered early (like opening the output
+// file) are torn down last.
+func atExit(f func()) {
+	exitMu.Lock()
+	exitFuncs = append(exitFuncs, f)
+	exitMu.Unlock()
+}
+
+// runExitFuncs calls all registered exit functions.
+func runExitFuncs() {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	for i := len(exitFuncs) - 1; i >= 0; i-- {
+		exitFuncs[i]()
+	}
+	exitFuncs = nil
+}
+
+// stopping is closed when we get SIGINT or SIGTERM, so that
+// processLoop can stop between reports instead of having the rug
+// pulled out from under it in the middle of one.
+var stopping = make(chan struct{})
+
+// stopGrace is how long processLoop gets to notice that we're stopping
+// before we stop anyway. It might be stuck waiting for a remote source.
+const stopGrace = 5 * time.Second
+
+// handleExitSignals arranges for the exit functions to run and then
+// for us to exit when we get SIGINT or SIGTERM. Normally processLoop
+// does this itself; if it doesn't, or we get a second signal, we do.
+func handleExitSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		close(stopping)
+		select {
+		case <-ch:
+		case <-time.After(stopGrace):
+		}
+		runExitFuncs()
+		os.Exit(0)
+	}()
+}
+
+// reloadWanted is set when we get a SIGHUP (to reloadSignal) or it's
+// time for a -rescan (to reloadRescan), and cleared when we act on it.
+var reloadWanted int32
+
+const (
+	reloadSignal = 1
+	reloadRescan = 2
+)
+
+// handleReloadSignal arranges for SIGHUP to set reloadWanted.
+func handleReloadSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			atomic.StoreInt32(&reloadWanted, reloadSignal)
+		}
+	}()
+}
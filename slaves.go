@@ -0,0 +1,36 @@
+//
+// Showing the members of bonds, teams and bridges under them (-slaves),
+// so you can see which member link is actually carrying the traffic.
+// Linux's sysfs tells us about a device's members with lower_<dev>
+// links in its directory; elsewhere, nothing has members.
+//
+
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var showSlaves bool
+
+// Devices that are stacked on top of a single parent also have a
+// lower_ link, but that's not membership.
+var stackedTypes = map[string]bool{
+	"vlan": true, "macvlan": true, "macvtap": true, "ipvlan": true,
+}
+
+// slavesOf returns the names of a device's members, if it has any.
+func slavesOf(dev string) []string {
+	if stackedTypes[devType(dev)] {
+		return nil
+	}
+	links, _ := filepath.Glob(filepath.Join("/sys/class/net", dev, "lower_*"))
+	var slaves []string
+	for _, l := range links {
+		slaves = append(slaves, strings.TrimPrefix(filepath.Base(l), "lower_"))
+	}
+	sort.Strings(slaves)
+	return slaves
+}
@@ -0,0 +1,29 @@
+//
+// SIGUSR1 gets you a snapshot of how things stand (see summary.go),
+// and SIGUSR2 the rate percentiles so far (see percentiles.go).
+//
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func handleSnapshotSignal(c *config) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ch {
+			if sig == syscall.SIGUSR2 {
+				printPercentiles(c, os.Stderr)
+			} else {
+				printSnapshot(c, os.Stderr)
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//
+// Windows has no SIGUSR1 or SIGUSR2, so no snapshots or percentiles
+// on demand.
+//
+
+//go:build windows
+// +build windows
+
+package main
+
+func handleSnapshotSignal(c *config) {}
@@ -0,0 +1,450 @@
+//
+// Collecting stats from a switch or router over SNMP (-snmp host),
+// instead of from this machine. We walk IF-MIB's 64-bit counters
+// (ifHCInOctets and friends) every interval and feed them into the
+// same deltas and reports as local devices, which are named by their
+// ifName. We do SNMP v2c, with the community given by -community, and
+// v3 without privacy (see snmpv3.go); v1 has no 64-bit counters.
+//
+// This has its own minimal SNMP client: just enough BER to send
+// GetBulk requests and read what comes back.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+var snmpHost, snmpCommunity, snmpVersion string
+
+// errOtherRequest is a reply to some request other than the one we're
+// waiting for.
+var errOtherRequest = errors.New("SNMP reply is for another request")
+
+// IF-MIB columns, without the ifIndex on the end.
+var (
+	oidIfDescr            = []uint32{1, 3, 6, 1, 2, 1, 2, 2, 1, 2}
+	oidIfType             = []uint32{1, 3, 6, 1, 2, 1, 2, 2, 1, 3}
+	oidIfName             = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 1}
+	oidIfHCInOctets       = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 6}
+	oidIfHCInUcastPkts    = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 7}
+	oidIfHCInMulticastPkt = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 8}
+	oidIfHCInBroadcastPkt = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 9}
+	oidIfHCOutOctets      = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 10}
+	oidIfHCOutUcastPkts   = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 11}
+	oidIfHCOutMulticast   = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 12}
+	oidIfHCOutBroadcast   = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 13}
+	oidIfAlias            = []uint32{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 18}
+)
+
+// ifType for loopbacks.
+const ifTypeSoftwareLoopback = 24
+
+// BER tags we use.
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berCounter32   = 0x41
+	berGauge32     = 0x42
+	berTimeTicks   = 0x43
+	berCounter64   = 0x46
+	berEndOfMib    = 0x82
+	pduGetBulk     = 0xa5
+	pduResponse    = 0xa2
+	pduReport      = 0xa8
+)
+
+// snmpValue is a value from a walk: a number for counters, gauges
+// and integers, or a string for octet strings.
+type snmpValue struct {
+	n uint64
+	s string
+}
+
+type snmpClient struct {
+	conn      net.Conn
+	community string
+	reqid     int32
+	// usm is set if we're using SNMP v3.
+	usm *snmpUSM
+}
+
+func newSNMPClient(host, community string) (*snmpClient, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "161")
+	}
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	return &snmpClient{conn: conn, community: community, reqid: rand.Int31()}, nil
+}
+
+// berTLV encodes one tag, length and value.
+func berTLV(tag byte, val []byte) []byte {
+	b := []byte{tag}
+	switch n := len(val); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n < 0x100:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+	return append(b, val...)
+}
+
+func berInt(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(berInteger, b)
+}
+
+func berOIDBytes(oid []uint32) []byte {
+	b := []byte{byte(oid[0]*40 + oid[1])}
+	for _, n := range oid[2:] {
+		var enc []byte
+		enc = append(enc, byte(n&0x7f))
+		for n >>= 7; n > 0; n >>= 7 {
+			enc = append([]byte{byte(n&0x7f) | 0x80}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return berTLV(berOID, b)
+}
+
+// berNext splits the first TLV off of b.
+func berNext(b []byte) (tag byte, val, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("short BER data")
+	}
+	tag = b[0]
+	n, hl := int(b[1]), 2
+	if n&0x80 != 0 {
+		nb := n & 0x7f
+		if nb == 0 || nb > 3 || len(b) < 2+nb {
+			return 0, nil, nil, errors.New("bad BER length")
+		}
+		n = 0
+		for _, c := range b[2 : 2+nb] {
+			n = n<<8 | int(c)
+		}
+		hl += nb
+	}
+	if len(b) < hl+n {
+		return 0, nil, nil, errors.New("truncated BER data")
+	}
+	return tag, b[hl : hl+n], b[hl+n:], nil
+}
+
+func berUint(val []byte) uint64 {
+	var n uint64
+	for _, c := range val {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func berParseOID(val []byte) []uint32 {
+	if len(val) == 0 {
+		return nil
+	}
+	oid := []uint32{uint32(val[0]) / 40, uint32(val[0]) % 40}
+	var n uint32
+	for _, c := range val[1:] {
+		n = n<<7 | uint32(c&0x7f)
+		if c&0x80 == 0 {
+			oid = append(oid, n)
+			n = 0
+		}
+	}
+	return oid
+}
+
+// getBulk sends a GetBulk for what comes after oid and returns the
+// varbinds in the response. Late replies to requests we've given up
+// on (including our own earlier tries) are ignored.
+func (c *snmpClient) getBulk(oid []uint32) ([][]uint32, []byte, [][]byte, error) {
+	c.reqid++
+	vb := berTLV(berSequence, berTLV(berSequence, append(berOIDBytes(oid), berNull, 0)))
+	pdu := berTLV(pduGetBulk, concat(berInt(int64(c.reqid)), berInt(0), berInt(25), vb))
+
+	buf := make([]byte, 65536)
+	var err error
+	resyncs := 0
+	for try := 0; try < 3; try++ {
+		// v3 messages depend on what we know of the agent,
+		// which replies can change.
+		if _, err = c.conn.Write(c.message(pdu)); err != nil {
+			return nil, nil, nil, err
+		}
+		c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	read:
+		for {
+			var n int
+			if n, err = c.conn.Read(buf); err != nil {
+				break
+			}
+			oids, tags, vals, perr := c.parseResponse(buf[:n])
+			switch {
+			case perr == errOtherRequest:
+				continue
+			case perr == errUSMResync && resyncs < 3:
+				// This doesn't count as a try.
+				resyncs++
+				try--
+				break read
+			}
+			return oids, tags, vals, perr
+		}
+	}
+	return nil, nil, nil, err
+}
+
+// message wraps a PDU up as a message for the SNMP version we're
+// using.
+func (c *snmpClient) message(pdu []byte) []byte {
+	if c.usm != nil {
+		return c.usm.message(c.reqid, pdu)
+	}
+	return berTLV(berSequence, concat(berInt(1), berTLV(berOctetString, []byte(c.community)), pdu))
+}
+
+// parseResponse parses a response to our current request.
+func (c *snmpClient) parseResponse(b []byte) ([][]uint32, []byte, [][]byte, error) {
+	var ptype, tag byte
+	var m, v []byte
+	var err error
+	if c.usm != nil {
+		if ptype, m, err = c.usm.unwrap(b, c.reqid); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		// SEQUENCE { version, community, PDU }
+		if _, m, _, err = berNext(b); err != nil {
+			return nil, nil, nil, err
+		}
+		for i := 0; i < 2; i++ {
+			if _, _, m, err = berNext(m); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if ptype, m, _, err = berNext(m); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if ptype != pduResponse && (ptype != pduReport || c.usm == nil) {
+		return nil, nil, nil, fmt.Errorf("unexpected SNMP PDU type 0x%x", ptype)
+	}
+
+	// The PDU is { reqid, status, index, SEQUENCE { SEQUENCE {
+	// OID, value } ... } }. Reports were checked against our
+	// request's message ID instead.
+	if _, v, m, err = berNext(m); err != nil {
+		return nil, nil, nil, err
+	}
+	if ptype == pduResponse && int32(berUint(v)) != c.reqid {
+		return nil, nil, nil, errOtherRequest
+	}
+	if _, v, m, err = berNext(m); err != nil {
+		return nil, nil, nil, err
+	}
+	if st := berUint(v); st != 0 && ptype == pduResponse {
+		return nil, nil, nil, fmt.Errorf("SNMP error status %d", st)
+	}
+	if _, _, m, err = berNext(m); err != nil {
+		return nil, nil, nil, err
+	}
+	if _, m, _, err = berNext(m); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var oids [][]uint32
+	var tags []byte
+	var vals [][]byte
+	for len(m) > 0 {
+		var one, ov []byte
+		if _, one, m, err = berNext(m); err != nil {
+			return nil, nil, nil, err
+		}
+		if _, ov, one, err = berNext(one); err != nil {
+			return nil, nil, nil, err
+		}
+		if tag, v, _, err = berNext(one); err != nil {
+			return nil, nil, nil, err
+		}
+		oids = append(oids, berParseOID(ov))
+		tags = append(tags, tag)
+		vals = append(vals, v)
+	}
+	if ptype == pduReport {
+		return nil, nil, nil, c.usm.report(oids)
+	}
+	return oids, tags, vals, nil
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// walk returns a table column's values, by index.
+func (c *snmpClient) walk(col []uint32) (map[int]snmpValue, error) {
+	res := make(map[int]snmpValue)
+	cur := col
+	last := -1
+	for {
+		oids, tags, vals, err := c.getBulk(cur)
+		if err != nil {
+			return nil, err
+		}
+		if len(oids) == 0 {
+			return res, nil
+		}
+		for i, oid := range oids {
+			if tags[i] == berEndOfMib || len(oid) != len(col)+1 || !oidHasPrefix(oid, col) {
+				return res, nil
+			}
+			// Agents are supposed to always move forward, but
+			// let's not loop forever if one doesn't.
+			idx := int(oid[len(col)])
+			if idx <= last {
+				return nil, errors.New("SNMP walk went backward")
+			}
+			last = idx
+			sv := snmpValue{}
+			switch tags[i] {
+			case berOctetString:
+				sv.s = string(vals[i])
+			case berInteger, berCounter32, berGauge32, berTimeTicks, berCounter64:
+				sv.n = berUint(vals[i])
+			}
+			res[idx] = sv
+			cur = oid
+		}
+	}
+}
+
+func oidHasPrefix(oid, prefix []uint32) bool {
+	for i, n := range prefix {
+		if oid[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+var snmp *snmpClient
+
+// snmpNames returns the remote device names by ifIndex, from ifName
+// or, on old gear without it, ifDescr.
+func snmpNames() (map[int]string, error) {
+	names, err := snmp.walk(oidIfName)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		if names, err = snmp.walk(oidIfDescr); err != nil {
+			return nil, err
+		}
+	}
+	byIdx := make(map[int]string)
+	for idx, v := range names {
+		byIdx[idx] = v.s
+	}
+	return byIdx, nil
+}
+
+// setupSNMP connects to the remote host and fills netinfo from what
+// it tells us. There are no IP addresses, so IP specifiers won't
+// match anything.
+func setupSNMP(ni *netInfo) error {
+	var err error
+	if snmp, err = newSNMPClient(snmpHost, snmpCommunity); err != nil {
+		return err
+	}
+	if snmpVersion == "3" {
+		if snmp.usm, err = newUSM(snmpUser, snmpAuth, snmpAuthPass); err != nil {
+			return err
+		}
+	}
+	names, err := snmpNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New("the host reported no interfaces")
+	}
+	types, err := snmp.walk(oidIfType)
+	if err != nil {
+		return err
+	}
+	aliases, err := snmp.walk(oidIfAlias)
+	if err != nil {
+		return err
+	}
+	for idx, name := range names {
+		ni.ifindex[name] = idx
+		if types[idx].n == ifTypeSoftwareLoopback {
+			ni.loopbacks.add(name)
+		}
+		if a := aliases[idx].s; a != "" {
+			ni.descs[name] = a
+		}
+	}
+	fillStats = fillSNMP
+	return nil
+}
+
+// fillSNMP is our fillStats. It always gets every device.
+func fillSNMP(s Stats, devs []string) error {
+	names, err := snmpNames()
+	if err != nil {
+		return err
+	}
+	cols := [][]uint32{
+		oidIfHCInOctets, oidIfHCOutOctets,
+		oidIfHCInUcastPkts, oidIfHCInMulticastPkt, oidIfHCInBroadcastPkt,
+		oidIfHCOutUcastPkts, oidIfHCOutMulticast, oidIfHCOutBroadcast,
+	}
+	vals := make([]map[int]snmpValue, len(cols))
+	for i, col := range cols {
+		if vals[i], err = snmp.walk(col); err != nil {
+			return err
+		}
+	}
+	if len(vals[0]) == 0 {
+		return errors.New("the host has no 64-bit interface counters (ifHCInOctets)")
+	}
+	when := time.Now()
+	for idx, name := range names {
+		if _, ok := vals[0][idx]; !ok {
+			continue
+		}
+		s[name] = DevStat{
+			When:     when,
+			RBytes:   vals[0][idx].n,
+			TBytes:   vals[1][idx].n,
+			RPackets: vals[2][idx].n + vals[3][idx].n + vals[4][idx].n,
+			TPackets: vals[5][idx].n + vals[6][idx].n + vals[7][idx].n,
+		}
+	}
+	return nil
+}
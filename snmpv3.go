@@ -0,0 +1,310 @@
+//
+// SNMP v3's User-based Security Model (USM, RFC 3414), for
+// -snmp-version 3. We do noAuthNoPriv (just a -snmp-user) and
+// authNoPriv, with HMAC-MD5-96 or HMAC-SHA-96 (-snmp-auth) keyed from
+// -snmp-auth-pass; we don't do privacy (encryption).
+//
+// We find the agent's engine ID, boots and time the standard way: our
+// first request goes out with no engine ID and no user, and the agent
+// answers with a report carrying them. If our idea of its time drifts
+// too far, it reports that with its current time and we try again.
+//
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+var snmpUser, snmpAuth, snmpAuthPass string
+
+// msgFlags bits.
+const (
+	usmAuth       = 0x01
+	usmPriv       = 0x02
+	usmReportable = 0x04
+)
+
+// The USM security model number, and the largest message we'll
+// take.
+const (
+	usmSecurityModel = 3
+	usmMaxSize       = 65507
+)
+
+// usmStats is usmStats in SNMP-USM-MIB, the OIDs of the counters
+// that come back in reports. Their last part is which one it is.
+var usmStats = []uint32{1, 3, 6, 1, 6, 3, 15, 1, 1}
+
+const (
+	usmUnsupportedSecLevels = 1
+	usmNotInTimeWindows     = 2
+	usmUnknownUserNames     = 3
+	usmUnknownEngineIDs     = 4
+	usmWrongDigests         = 5
+	usmDecryptionErrors     = 6
+)
+
+var usmReportWhy = map[uint32]string{
+	usmUnsupportedSecLevels: "the agent doesn't support this security level",
+	usmUnknownUserNames:     "the agent doesn't know -snmp-user",
+	usmWrongDigests:         "authentication failed (is -snmp-auth or -snmp-auth-pass wrong?)",
+	usmDecryptionErrors:     "the agent couldn't decrypt our request",
+}
+
+// errUSMResync is how a reply tells getBulk that we've learned the
+// agent's engine ID or time and should send our request again.
+var errUSMResync = errors.New("the SNMP v3 agent's engine ID or time keeps changing")
+
+// snmpUSM is our side of USM for one agent.
+type snmpUSM struct {
+	user string
+	// auth is nil for noAuthNoPriv. passKey is the key from our
+	// password, and key that localized to the agent's engine ID.
+	auth    func() hash.Hash
+	passKey []byte
+	key     []byte
+
+	// What we know of the agent's engine, and when we learned
+	// its time.
+	engineID []byte
+	boots    int64
+	etime    int64
+	synced   time.Time
+
+	// The engine information from the last reply, for reports.
+	last usmParams
+}
+
+// usmParams is the engine information in a message's USM security
+// parameters.
+type usmParams struct {
+	engineID []byte
+	boots    int64
+	etime    int64
+}
+
+func newUSM(user, auth, pass string) (*snmpUSM, error) {
+	u := &snmpUSM{user: user}
+	switch auth {
+	case "":
+		return u, nil
+	case "md5":
+		u.auth = md5.New
+	case "sha":
+		u.auth = sha1.New
+	default:
+		return nil, fmt.Errorf("unknown authentication protocol '%s' (we do md5 and sha)", auth)
+	}
+	// RFC 3414 says passwords must be at least 8 characters, and
+	// agents are entitled to refuse shorter ones.
+	if len(pass) < 8 {
+		return nil, errors.New("the authentication password must be at least 8 characters")
+	}
+	u.passKey = passwordToKey(u.auth, []byte(pass))
+	return u, nil
+}
+
+// passwordToKey turns a password into a key the RFC 3414 way, by
+// hashing a megabyte of it repeated over and over.
+func passwordToKey(h func() hash.Hash, pass []byte) []byte {
+	hh := h()
+	buf := make([]byte, 64)
+	j := 0
+	for n := 0; n < 1024*1024; n += len(buf) {
+		for i := range buf {
+			buf[i] = pass[j%len(pass)]
+			j++
+		}
+		hh.Write(buf)
+	}
+	return hh.Sum(nil)
+}
+
+// localizeKey localizes a password key to an engine ID.
+func localizeKey(h func() hash.Hash, key, engineID []byte) []byte {
+	hh := h()
+	hh.Write(key)
+	hh.Write(engineID)
+	hh.Write(key)
+	return hh.Sum(nil)
+}
+
+// mac is the HMAC-*-96 of msg: the first 12 bytes of its HMAC.
+func (u *snmpUSM) mac(msg []byte) []byte {
+	m := hmac.New(u.auth, u.key)
+	m.Write(msg)
+	return m.Sum(nil)[:12]
+}
+
+// authing is whether our requests are authenticated. Until we know
+// the agent's engine ID, they can't be.
+func (u *snmpUSM) authing() bool {
+	return u.auth != nil && len(u.engineID) > 0
+}
+
+// message wraps a PDU up as a v3 message, authenticating it if we're
+// doing that.
+func (u *snmpUSM) message(msgID int32, pdu []byte) []byte {
+	flags := byte(usmReportable)
+	user := u.user
+	var etime int64
+	var authParams []byte
+	switch {
+	case len(u.engineID) == 0:
+		// Discovery is done with no user.
+		user = ""
+	case u.authing():
+		flags |= usmAuth
+		authParams = make([]byte, 12)
+		etime = u.etime + int64(time.Since(u.synced)/time.Second)
+	default:
+		etime = u.etime + int64(time.Since(u.synced)/time.Second)
+	}
+
+	global := berTLV(berSequence, concat(berInt(int64(msgID)), berInt(usmMaxSize),
+		berTLV(berOctetString, []byte{flags}), berInt(usmSecurityModel)))
+	// The authentication parameters go last but one, before the
+	// (empty) privacy parameters.
+	secHead := concat(berTLV(berOctetString, u.engineID), berInt(u.boots), berInt(etime),
+		berTLV(berOctetString, []byte(user)))
+	sec := berTLV(berSequence, concat(secHead, berTLV(berOctetString, authParams), berTLV(berOctetString, nil)))
+	scoped := berTLV(berSequence, concat(berTLV(berOctetString, u.engineID), berTLV(berOctetString, nil), pdu))
+	secParams := berTLV(berOctetString, sec)
+	body := concat(berInt(3), global, secParams, scoped)
+	msg := berTLV(berSequence, body)
+
+	if flags&usmAuth != 0 {
+		// Only the two bytes of the empty privacy parameters
+		// come after the authentication parameters in
+		// secParams.
+		off := len(msg) - len(body) + len(berInt(3)) + len(global) + len(secParams) - 2 - 12
+		copy(msg[off:], u.mac(msg))
+	}
+	return msg
+}
+
+// berReader reads TLVs one after another, remembering the first
+// error.
+type berReader struct {
+	b   []byte
+	err error
+}
+
+func (r *berReader) next() (byte, []byte) {
+	if r.err != nil {
+		return 0, nil
+	}
+	tag, val, rest, err := berNext(r.b)
+	r.b, r.err = rest, err
+	return tag, val
+}
+
+// unwrap checks a v3 message that's a reply to msgID, and returns its
+// PDU's tag and contents.
+func (u *snmpUSM) unwrap(b []byte, msgID int32) (byte, []byte, error) {
+	msg := &berReader{b: b}
+	_, m := msg.next()
+	r := &berReader{b: m}
+	_, v := r.next()
+	if r.err == nil && berUint(v) != 3 {
+		return 0, nil, fmt.Errorf("reply is SNMP version %d, not 3", berUint(v))
+	}
+	_, gd := r.next()
+	_, sp := r.next()
+	_, spdu := r.next()
+	if r.err = firstErr(r.err, msg.err); r.err != nil {
+		return 0, nil, r.err
+	}
+
+	g := &berReader{b: gd}
+	_, v = g.next()
+	if g.err == nil && int32(berUint(v)) != msgID {
+		return 0, nil, errOtherRequest
+	}
+	g.next()
+	_, fl := g.next()
+	if g.err == nil && len(fl) != 1 {
+		return 0, nil, errors.New("bad SNMP v3 message flags")
+	}
+
+	s := &berReader{b: sp}
+	_, sec := s.next()
+	s = &berReader{b: sec}
+	_, engineID := s.next()
+	_, boots := s.next()
+	_, etime := s.next()
+	s.next()
+	_, authParams := s.next()
+
+	p := &berReader{b: spdu}
+	p.next()
+	p.next()
+	tag, pdu := p.next()
+	if err := firstErr(g.err, s.err, p.err); err != nil {
+		return 0, nil, err
+	}
+
+	switch {
+	case fl[0]&usmPriv != 0:
+		return 0, nil, errors.New("SNMP v3 reply is encrypted")
+	case fl[0]&usmAuth != 0:
+		if !u.authing() || len(authParams) != 12 {
+			return 0, nil, errors.New("SNMP v3 reply is authenticated when we aren't")
+		}
+		// authParams is part of b, so where it starts in b
+		// is how much less room it has.
+		off := cap(b) - cap(authParams)
+		c := append([]byte(nil), b...)
+		copy(c[off:off+12], make([]byte, 12))
+		if !hmac.Equal(u.mac(c), authParams) {
+			return 0, nil, errors.New("SNMP v3 reply failed authentication")
+		}
+	case u.authing() && tag != pduReport:
+		return 0, nil, errors.New("SNMP v3 reply isn't authenticated")
+	}
+	u.last = usmParams{engineID, int64(berUint(boots)), int64(berUint(etime))}
+	return tag, pdu, nil
+}
+
+func firstErr(errs ...error) error {
+	for _, e := range errs {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// report handles a report in reply to a request, given its OIDs. If
+// it tells us the agent's engine ID or time, we take them and ask for
+// the request to be sent again.
+func (u *snmpUSM) report(oids [][]uint32) error {
+	if len(oids) == 0 || len(oids[0]) != len(usmStats)+2 || !oidHasPrefix(oids[0], usmStats) {
+		return errors.New("SNMP v3 agent sent an unknown report")
+	}
+	switch why := oids[0][len(usmStats)]; why {
+	case usmUnknownEngineIDs, usmNotInTimeWindows:
+		if len(u.last.engineID) == 0 {
+			return errors.New("SNMP v3 agent didn't tell us its engine ID")
+		}
+		u.engineID = u.last.engineID
+		u.boots, u.etime = u.last.boots, u.last.etime
+		u.synced = time.Now()
+		if u.auth != nil {
+			u.key = localizeKey(u.auth, u.passKey, u.engineID)
+		}
+		return errUSMResync
+	default:
+		if s, ok := usmReportWhy[why]; ok {
+			return errors.New("SNMP v3: " + s)
+		}
+		return fmt.Errorf("SNMP v3 agent sent report %d", why)
+	}
+}
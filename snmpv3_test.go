@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"net"
+	"testing"
+	"time"
+)
+
+// The examples from RFC 3414 appendix A.3.
+func TestLocalizeKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	tests := []struct {
+		name   string
+		h      func() hash.Hash
+		ku, kl string
+	}{
+		{"md5", md5.New, "9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+		{"sha", sha1.New, "9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	for _, tc := range tests {
+		ku := passwordToKey(tc.h, []byte("maplesyrup"))
+		if got := hex.EncodeToString(ku); got != tc.ku {
+			t.Errorf("%s: password key %s, want %s", tc.name, got, tc.ku)
+		}
+		if got := hex.EncodeToString(localizeKey(tc.h, ku, engineID)); got != tc.kl {
+			t.Errorf("%s: localized key %s, want %s", tc.name, got, tc.kl)
+		}
+	}
+}
+
+// testAgent answers SNMP v3 requests for ifName with one interface,
+// eth0, after the client discovers its engine. It uses our own USM
+// code for its side, as the authoritative engine.
+func testAgent(t *testing.T, pass string) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	engineID := []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 'n', 'v', 'm'}
+	auth := &snmpUSM{
+		user: "monitor", auth: sha1.New,
+		key:      localizeKey(sha1.New, passwordToKey(sha1.New, []byte(pass)), engineID),
+		engineID: engineID, boots: 3, etime: 1000, synced: time.Now(),
+	}
+	noauth := &snmpUSM{engineID: engineID, boots: 3, etime: 1000, synced: time.Now()}
+
+	varbind := func(oid []uint32, val []byte) []byte {
+		return berTLV(berSequence, concat(berOIDBytes(oid), val))
+	}
+	reply := func(ptype byte, reqid uint64, vbs ...[]byte) []byte {
+		return berTLV(ptype, concat(berInt(int64(reqid)), berInt(0), berInt(0), berTLV(berSequence, concat(vbs...))))
+	}
+	report := func(which uint32) []byte {
+		return reply(pduReport, 0, varbind(append(usmStats, which, 0), berTLV(berCounter32, []byte{1})))
+	}
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// The message ID is the first thing in the global
+			// data, after the version.
+			msg := &berReader{b: buf[:n]}
+			_, m := msg.next()
+			r := &berReader{b: m}
+			r.next()
+			_, gd := r.next()
+			g := &berReader{b: gd}
+			_, v := g.next()
+			msgID := int32(berUint(v))
+
+			var out []byte
+			_, pdu, err := auth.unwrap(buf[:n], msgID)
+			switch {
+			case err != nil && bytes.Contains(buf[:n], engineID):
+				out = noauth.message(msgID, report(usmWrongDigests))
+			case err != nil:
+				out = noauth.message(msgID, report(usmUnknownEngineIDs))
+			default:
+				// Walks go on from the last OID they got.
+				_, reqid, _, _ := berNext(pdu)
+				if bytes.Contains(pdu, berOIDBytes(append(oidIfName, 1))) {
+					out = auth.message(msgID, reply(pduResponse, berUint(reqid),
+						varbind(oidIfAlias, berTLV(berOctetString, nil))))
+				} else {
+					out = auth.message(msgID, reply(pduResponse, berUint(reqid),
+						varbind(append(oidIfName, 1), berTLV(berOctetString, []byte("eth0")))))
+				}
+			}
+			pc.WriteTo(out, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestSNMPv3Walk(t *testing.T) {
+	addr := testAgent(t, "maplesyrup")
+	c, err := newSNMPClient(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.usm, err = newUSM("monitor", "sha", "maplesyrup"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := c.walk(oidIfName)
+	if err != nil {
+		t.Fatalf("walk: %s", err)
+	}
+	if len(names) != 1 || names[1].s != "eth0" {
+		t.Errorf("got names %v, want eth0 at 1", names)
+	}
+	if c.usm.boots != 3 || len(c.usm.engineID) == 0 {
+		t.Errorf("didn't discover the engine: boots %d, engine ID %x", c.usm.boots, c.usm.engineID)
+	}
+}
+
+func TestSNMPv3WrongPassword(t *testing.T) {
+	addr := testAgent(t, "maplesyrup")
+	c, err := newSNMPClient(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.usm, err = newUSM("monitor", "sha", "pancakes!"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.walk(oidIfName); err == nil || err.Error() != "SNMP v3: "+usmReportWhy[usmWrongDigests] {
+		t.Errorf("got error %v, want a wrong digest report", err)
+	}
+}
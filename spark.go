@@ -0,0 +1,63 @@
+//
+// Sparklines (-spark N). We keep each device's last N RX and TX rates
+// and draw them as little Unicode bar charts on its line, so that you
+// can see at a glance what it's been doing lately. Each sparkline is
+// scaled to its own maximum, so they show shape, not size.
+//
+
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+var sparkWidth int
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// A sparkHistory is a device's recent rates, oldest first.
+type sparkHistory struct {
+	rx, tx []float64
+}
+
+var sparkHist = make(map[string]*sparkHistory)
+
+// sparkline draws rates as a sparkline, padded on the left to our
+// full width so that columns line up while history builds up.
+func sparkline(rates []float64) string {
+	max := 0.0
+	for _, r := range rates {
+		if r > max {
+			max = r
+		}
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", sparkWidth-len(rates)))
+	for _, r := range rates {
+		i := 0
+		if max > 0 {
+			i = int(r / max * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[i])
+	}
+	return b.String()
+}
+
+// sparkFor adds a device's interval to its history and returns RX
+// and TX sparklines for it.
+func sparkFor(devname string, dt DevDelta) (string, string) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	h, ok := sparkHist[devname]
+	if !ok {
+		h = &sparkHistory{}
+		sparkHist[devname] = h
+	}
+	h.rx = append(h.rx, float64(dt.RBytes)/persec)
+	h.tx = append(h.tx, float64(dt.TBytes)/persec)
+	if len(h.rx) > sparkWidth {
+		h.rx = h.rx[1:]
+		h.tx = h.tx[1:]
+	}
+	return sparkline(h.rx), sparkline(h.tx)
+}
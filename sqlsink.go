@@ -0,0 +1,131 @@
+//
+// Insert per-device samples into a SQL database through database/sql,
+// with -sql driver:DSN. We build in the Postgres driver (as
+// 'postgres'); other drivers need to be added to the imports here.
+// The table should look something like (for Postgres):
+//
+//	CREATE TABLE netvolmon (
+//	    time timestamptz NOT NULL,
+//	    host text NOT NULL,
+//	    device text NOT NULL,
+//	    interval double precision,
+//	    rx_bps double precision, tx_bps double precision,
+//	    rx_pps double precision, tx_pps double precision
+//	);
+//
+// Rates are bytes and packets per second; interval is in seconds.
+// Like ClickHouse, inserts are batched and happen in the background
+// (see batch.go).
+//
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+var sqlSpec string
+var sqlTable string
+var sqlBatch int
+
+// sqlColumns is the columns we insert, in order.
+var sqlColumns = []string{"time", "host", "device", "interval", "rx_bps", "tx_bps", "rx_pps", "tx_pps"}
+
+type sqlRow struct {
+	when     time.Time
+	device   string
+	interval float64
+	rates    [4]float64
+}
+
+// A sqlSink turns device intervals into rows for its batcher to
+// insert.
+type sqlSink struct {
+	db     *sql.DB
+	host   string
+	table  string
+	dollar bool
+	rows   *batcher[sqlRow]
+}
+
+func newSQLSink(spec, table string, batch int) (*sqlSink, error) {
+	driver, dsn, ok := strings.Cut(spec, ":")
+	if !ok || driver == "" || dsn == "" {
+		return nil, fmt.Errorf("'%s' is not driver:DSN", spec)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	ss := &sqlSink{
+		db:    db,
+		host:  host,
+		table: table,
+		// Postgres drivers want $1 style placeholders.
+		dollar: driver == "postgres" || driver == "pgx",
+	}
+	ss.rows = newBatcher("sql", batch, ss.insert)
+	return ss, nil
+}
+
+// add adds a device's interval to the pending batch.
+func (ss *sqlSink) add(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	ss.rows.add(sqlRow{
+		when:     dt.When.UTC(),
+		device:   devname,
+		interval: persec,
+		rates: [4]float64{
+			float64(dt.RBytes) / persec, float64(dt.TBytes) / persec,
+			float64(dt.RPackets) / persec, float64(dt.TPackets) / persec,
+		},
+	})
+}
+
+// flush is called at the end of every interval.
+func (ss *sqlSink) flush() { ss.rows.flush() }
+
+// close inserts what's left when we stop.
+func (ss *sqlSink) close() {
+	ss.rows.close()
+	ss.db.Close()
+}
+
+// insert inserts rows as a single multi-row INSERT.
+func (ss *sqlSink) insert(rows []sqlRow) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", ss.table, strings.Join(sqlColumns, ", "))
+	args := make([]interface{}, 0, len(rows)*len(sqlColumns))
+	for i, r := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range sqlColumns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			if ss.dollar {
+				fmt.Fprintf(&b, "$%d", len(args)+j+1)
+			} else {
+				b.WriteString("?")
+			}
+		}
+		b.WriteString(")")
+		args = append(args, r.when, ss.host, r.device, r.interval,
+			r.rates[0], r.rates[1], r.rates[2], r.rates[3])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := ss.db.ExecContext(ctx, b.String(), args...)
+	return err
+}
@@ -0,0 +1,92 @@
+//
+// Saving and resuming monitoring state (-state). When we stop, we
+// write our last raw stats snapshot and the device specifiers we were
+// given to a state file. When we start with the same state file, we
+// immediately report on the deltas from that snapshot to now, so
+// periodic short runs and restarts don't lose the time in between.
+//
+// If no devices are given on the command line, we monitor whatever
+// devices the state file says we were monitoring last time.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var stateFile string
+
+// savedState is what goes in the state file.
+type savedState struct {
+	Devices []string `json:"devices"`
+	Stats   Stats    `json:"stats"`
+}
+
+// resumeStats is the snapshot loaded from the state file, if any.
+var resumeStats Stats
+
+// lastStats is the most recent snapshot we've taken, which is what
+// we'll save. It's updated by processLoop and read at exit.
+var lastMu sync.Mutex
+var lastStats Stats
+
+func noteStats(st Stats) {
+	lastMu.Lock()
+	lastStats = st
+	lastMu.Unlock()
+	if recordOut != nil {
+		recordStats(st)
+	}
+}
+
+// loadState loads a state file. A state file that doesn't exist yet
+// isn't an error; we just return nil.
+func loadState(fname string) (*savedState, error) {
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ss := &savedState{}
+	if err := json.Unmarshal(data, ss); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// saveState saves our current state. We write a new file and rename
+// it into place, so a crash can't leave a half-written state file.
+func saveState(fname string, devices []string) error {
+	lastMu.Lock()
+	ss := savedState{Devices: devices, Stats: lastStats}
+	lastMu.Unlock()
+	if ss.Stats == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(&ss)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), ".netvolmon-state")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fname)
+}
@@ -0,0 +1,103 @@
+//
+// A statsd sink (-statsd), for places that already have statsd or
+// the Datadog agent listening. Every interval we send a gauge for
+// each device's rates over UDP:
+//
+//	netvolmon.<host>.<device>.rx_bytes:<rate>|g
+//
+// or with -statsd-tags, DogStatsD style with the host and device as
+// tags instead of in the name:
+//
+//	netvolmon.rx_bytes:<rate>|g|#host:<host>,device:<device>
+//
+// The values are per second rates, as usual. UDP means that if nothing
+// is listening, the metrics just go nowhere.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var statsdAddr string
+var statsdPrefix string
+var statsdTags bool
+
+// statsdPacket is how big we let a packet get, to stay under a
+// typical MTU.
+const statsdPacket = 1400
+
+// A statsdSink accumulates an interval's metrics and sends them in as
+// few packets as it can.
+type statsdSink struct {
+	conn    net.Conn
+	prefix  string
+	host    string
+	tags    bool
+	buf     bytes.Buffer
+	packets [][]byte
+}
+
+// statsd uses ':' and '|' itself, and '.' makes levels in names.
+var statsdName = strings.NewReplacer(".", "_", ":", "_", "|", "_", " ", "_", "/", "_", "@", "_", "#", "_", ",", "_")
+
+func newStatsdSink(addr, prefix string, tags bool) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &statsdSink{conn: conn, prefix: prefix, host: statsdName.Replace(host), tags: tags}, nil
+}
+
+// add adds a device's interval to what we'll send.
+func (ss *statsdSink) add(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	dev := statsdName.Replace(devname)
+	put := func(name string, v uint64) {
+		var line string
+		if ss.tags {
+			line = fmt.Sprintf("%s%s:%s|g|#host:%s,device:%s\n", ss.prefix, name, fmtFloat(float64(v)/persec), ss.host, dev)
+		} else {
+			line = fmt.Sprintf("%s%s.%s.%s:%s|g\n", ss.prefix, ss.host, dev, name, fmtFloat(float64(v)/persec))
+		}
+		if ss.buf.Len()+len(line) > statsdPacket && ss.buf.Len() > 0 {
+			ss.packets = append(ss.packets, append([]byte(nil), ss.buf.Bytes()...))
+			ss.buf.Reset()
+		}
+		ss.buf.WriteString(line)
+	}
+	put("rx_bytes", dt.RBytes)
+	put("tx_bytes", dt.TBytes)
+	put("rx_packets", dt.RPackets)
+	put("tx_packets", dt.TPackets)
+}
+
+// flush sends everything accumulated this interval. Failures are
+// logged but not fatal, and the metrics are dropped.
+func (ss *statsdSink) flush() {
+	if ss.buf.Len() > 0 {
+		ss.packets = append(ss.packets, ss.buf.Bytes())
+	}
+	for _, p := range ss.packets {
+		if _, err := ss.conn.Write(p); err != nil {
+			log.Print("sending to statsd failed: ", err)
+			break
+		}
+	}
+	ss.packets = nil
+	ss.buf.Reset()
+}
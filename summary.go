@@ -0,0 +1,164 @@
+//
+// End of run summaries. When asked to (-s), we keep track of a few
+// things about every device we report on and print a summary of them
+// when we're stopped. -peaks uses the same tracking to show each
+// device's peak rates so far as we go, and -cum its running totals.
+//
+// We always keep track, because SIGUSR1 gets you a snapshot of how
+// things stand so far, with each device's total traffic and average
+// rates as well as its peaks, whether or not you asked for -s. It goes
+// to standard error, so it doesn't get tangled up with the reports.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A devSummary is what we know about a device over the whole run.
+// Rates are in bytes per second.
+type devSummary struct {
+	intervals int
+	bursts    int
+	rxBytes   uint64
+	txBytes   uint64
+	span      time.Duration
+	maxRX     float64
+	maxRXWhen time.Time
+	maxTX     float64
+	maxTXWhen time.Time
+}
+
+var showSummary bool
+var showPeaks bool
+var showCum bool
+
+// summaries is updated by processLoop and read by the exit signal
+// handler, so it has to be locked.
+var sumMu sync.Mutex
+var summaries = make(map[string]*devSummary)
+var sumStart = time.Now()
+
+// noteDelta records a device's interval in its summary, including
+// whether or not it was a burst.
+func noteDelta(devname string, dt DevDelta, burst bool) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	rx := float64(dt.RBytes) / persec
+	tx := float64(dt.TBytes) / persec
+
+	sumMu.Lock()
+	defer sumMu.Unlock()
+	ds, ok := summaries[devname]
+	if !ok {
+		ds = &devSummary{}
+		summaries[devname] = ds
+	}
+	ds.intervals++
+	ds.rxBytes += dt.RBytes
+	ds.txBytes += dt.TBytes
+	ds.span += dt.Delta
+	if burst {
+		ds.bursts++
+	}
+	if rx > ds.maxRX || ds.maxRXWhen.IsZero() {
+		ds.maxRX = rx
+		ds.maxRXWhen = dt.When
+	}
+	if tx > ds.maxTX || ds.maxTXWhen.IsZero() {
+		ds.maxTX = tx
+		ds.maxTXWhen = dt.When
+	}
+}
+
+// devPeaks returns a device's peak RX and TX rates so far.
+func devPeaks(devname string) (float64, float64) {
+	sumMu.Lock()
+	defer sumMu.Unlock()
+	ds, ok := summaries[devname]
+	if !ok {
+		return 0, 0
+	}
+	return ds.maxRX, ds.maxTX
+}
+
+// devTotals returns how many bytes a device has received and sent so
+// far.
+func devTotals(devname string) (uint64, uint64) {
+	sumMu.Lock()
+	defer sumMu.Unlock()
+	ds, ok := summaries[devname]
+	if !ok {
+		return 0, 0
+	}
+	return ds.rxBytes, ds.txBytes
+}
+
+// fmtRate formats a bytes per second rate in our current units.
+func (c *config) fmtRate(bps float64) string {
+	bwD, bwU := c.getBwDiv(bps)
+	return fmt.Sprintf("%6.2f %s", bps/bwD, bwU)
+}
+
+// printSummary writes out the end of run summary.
+func printSummary(c *config, w io.Writer) {
+	sumMu.Lock()
+	defer sumMu.Unlock()
+
+	keys := sortedKeys(summaries)
+	if len(keys) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nsummary over %s:\n", time.Since(sumStart).Round(time.Second))
+	for _, k := range keys {
+		ds := summaries[k]
+		fmt.Fprintf(w, "%s peak RX %s at %s   peak TX %s at %s", fmtName(devLabel(k)),
+			c.fmtRate(ds.maxRX), stamp(ds.maxRXWhen),
+			c.fmtRate(ds.maxTX), stamp(ds.maxTXWhen))
+		if burstFactor > 0 {
+			fmt.Fprintf(w, "   bursts: %d of %d", ds.bursts, ds.intervals)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// fmtBytes formats a byte count in binary units.
+func fmtBytes(n uint64) string {
+	const tB = gB * 1024
+	switch {
+	case n >= tB:
+		return fmt.Sprintf("%.2f TB", float64(n)/tB)
+	case n >= gB:
+		return fmt.Sprintf("%.2f GB", float64(n)/gB)
+	case n >= mB:
+		return fmt.Sprintf("%.2f MB", float64(n)/mB)
+	case n >= kB:
+		return fmt.Sprintf("%.2f KB", float64(n)/kB)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// printSnapshot writes out how things stand so far, for SIGUSR1.
+func printSnapshot(c *config, w io.Writer) {
+	sumMu.Lock()
+	defer sumMu.Unlock()
+
+	keys := sortedKeys(summaries)
+
+	fmt.Fprintf(w, "netvolmon: snapshot after %s:\n", time.Since(sumStart).Round(time.Second))
+	for _, k := range keys {
+		ds := summaries[k]
+		secs := ds.span.Seconds()
+		if secs <= 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s total RX %s TX %s   avg RX %s TX %s   peak RX %s TX %s\n", fmtName(devLabel(k)),
+			fmtBytes(ds.rxBytes), fmtBytes(ds.txBytes),
+			c.fmtRate(float64(ds.rxBytes)/secs), c.fmtRate(float64(ds.txBytes)/secs),
+			c.fmtRate(ds.maxRX), c.fmtRate(ds.maxTX))
+	}
+}
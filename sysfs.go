@@ -0,0 +1,36 @@
+//
+// Reading per-interface information from Linux's /sys/class/net.
+// Everything here quietly returns nothing on systems (or for devices)
+// without the relevant sysfs files, so it's safe to call anywhere.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysfsNetAttr returns the (whitespace trimmed) contents of the
+// given attribute file for a network device, or "" if it can't be
+// read.
+func sysfsNetAttr(dev, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join("/sys/class/net", dev, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// sysfsLink returns the last part of where a device's sysfs entry
+// (such as 'master' or 'device/driver') points, or "" if it isn't
+// there.
+func sysfsLink(dev, name string) string {
+	l, err := os.Readlink(filepath.Join("/sys/class/net", dev, name))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(l)
+}
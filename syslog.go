@@ -0,0 +1,75 @@
+//
+// Sending reports to the system log (-syslog) or the systemd journal
+// (-journal), for servers where nobody's watching a terminal. Either
+// can have every device's line each interval ('reports') or only
+// -alert's alerts ('alerts'). To syslog, each message is key=value
+// pairs:
+//
+//	device=eth0 rx_bytes=1234.5 tx_bytes=678.9 rx_packets=12.0 tx_packets=8.0
+//
+// all per second, as usual, so it's easy to pick apart later. To the
+// journal, the same values are also structured fields, NETVOLMON_DEVICE,
+// NETVOLMON_RX_BYTES and so on, for 'journalctl NETVOLMON_DEVICE=eth0'.
+// Alerts have NETVOLMON_ALERT and NETVOLMON_RATE instead of the rates.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var syslogWhat, journalWhat string
+
+// sysLogTo sends a message with its fields to wherever it goes. It's
+// set up by setupSysLog (in syslog_*.go).
+var sysLogTo func(alert bool, fields [][2]string) error
+
+// sysLogReports is whether we send every device's line, not just
+// alerts.
+var sysLogReports bool
+
+// sysLogMessage turns fields into a key=value message.
+func sysLogMessage(fields [][2]string) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f[0] + "=" + f[1]
+	}
+	return strings.Join(parts, " ")
+}
+
+func sysLogSend(alert bool, fields [][2]string) {
+	if err := sysLogTo(alert, fields); err != nil {
+		log.Print("sending to the system log failed: ", err)
+	}
+}
+
+// sysLogDevice sends a device's interval, if we're sending reports.
+func sysLogDevice(devname string, dt DevDelta) {
+	if !sysLogReports {
+		return
+	}
+	persec := float64(dt.Delta) / float64(time.Second)
+	rate := func(n uint64) string {
+		return fmt.Sprintf("%.1f", float64(n)/persec)
+	}
+	sysLogSend(false, [][2]string{
+		{"device", devname},
+		{"rx_bytes", rate(dt.RBytes)},
+		{"tx_bytes", rate(dt.TBytes)},
+		{"rx_packets", rate(dt.RPackets)},
+		{"tx_packets", rate(dt.TPackets)},
+	})
+}
+
+// sysLogAlert sends an alert.
+func sysLogAlert(devname string, ac alertCond, rate float64) {
+	sysLogSend(true, [][2]string{
+		{"device", devname},
+		{"alert", ac.text},
+		{"rate", fmtFloat(rate)},
+	})
+}
@@ -0,0 +1,12 @@
+//
+// There's no syslog or journal here.
+//
+
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+func setupSysLog() error {
+	return unsupported("-syslog and -journal aren't supported on this system")
+}
@@ -0,0 +1,58 @@
+//
+// The system log and the journal, on Unix.
+//
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"bytes"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// setupSysLog connects to syslog or the journal. Alerts are warnings;
+// everything else is informational.
+func setupSysLog() error {
+	if syslogWhat != "" {
+		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "netvolmon")
+		if err != nil {
+			return err
+		}
+		atExit(func() { w.Close() })
+		sysLogTo = func(alert bool, fields [][2]string) error {
+			if alert {
+				return w.Warning(sysLogMessage(fields))
+			}
+			return w.Info(sysLogMessage(fields))
+		}
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return err
+	}
+	atExit(func() { conn.Close() })
+	sysLogTo = func(alert bool, fields [][2]string) error {
+		var b bytes.Buffer
+		pri := "6"
+		if alert {
+			pri = "4"
+		}
+		b.WriteString("MESSAGE=" + sysLogMessage(fields) + "\n")
+		b.WriteString("PRIORITY=" + pri + "\n")
+		b.WriteString("SYSLOG_IDENTIFIER=netvolmon\n")
+		for _, f := range fields {
+			b.WriteString("NETVOLMON_" + strings.ToUpper(f[0]) + "=" + f[1] + "\n")
+		}
+		_, err := conn.Write(b.Bytes())
+		return err
+	}
+	return nil
+}
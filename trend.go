@@ -0,0 +1,71 @@
+//
+// Trend indicators (-trend): is each device's RX and TX rate going
+// up, going down, or holding steady compared to the last interval?
+// -change says by how much, eg '+12.30', in the units of the line,
+// which makes ramping transfers and sudden drops stand out.
+//
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+var showTrend bool
+var showChange bool
+
+// Changes of less than this fraction of the previous rate count as
+// steady, so that normal jitter doesn't make the arrows flicker.
+const trendSteady = 0.10
+
+type rates struct {
+	rx, tx float64
+}
+
+var lastRates = make(map[string]rates)
+
+// trendMark returns the trend marker for a change from old to new.
+func trendMark(old, new float64) string {
+	switch {
+	case new > old*(1+trendSteady) && new-old >= 1:
+		return "↑"
+	case new < old*(1-trendSteady) && old-new >= 1:
+		return "↓"
+	default:
+		return " "
+	}
+}
+
+// noteRates remembers a device's rates for this interval, returning
+// them, its rates last interval, and whether we saw it then.
+func noteRates(devname string, dt DevDelta) (rates, rates, bool) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	cur := rates{float64(dt.RBytes) / persec, float64(dt.TBytes) / persec}
+	prev, ok := lastRates[devname]
+	lastRates[devname] = cur
+	return prev, cur, ok
+}
+
+// trendFor returns RX and TX trend markers for a change in rates. A
+// device we haven't seen before has no trend.
+func trendFor(prev, cur rates, seen bool) (string, string) {
+	if !seen {
+		return " ", " "
+	}
+	return trendMark(prev.rx, cur.rx), trendMark(prev.tx, cur.tx)
+}
+
+// printChange prints a device's change in RX and TX rates (in
+// bytes/sec) on its line, in the same units as the line.
+func printChange(c *config, rx, tx, bwD float64) {
+	if c.perRateUnits {
+		rxD, rxU := c.getRateDiv(math.Abs(rx))
+		txD, txU := c.getRateDiv(math.Abs(tx))
+		fmt.Fprintf(out, "   change: %+7.2f %-6s RX %+7.2f %-6s TX",
+			rx/rxD, rxU, tx/txD, txU)
+	} else {
+		fmt.Fprintf(out, "   change: %+7.2f RX %+7.2f TX", rx/bwD, tx/bwD)
+	}
+}
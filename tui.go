@@ -0,0 +1,238 @@
+//
+// The interactive full-screen mode (-tui). This is -S with a few
+// keys to drive it: you can re-sort the table (it starts out in -sort
+// order), change the units, pause the display, and filter devices by
+// a glob pattern.
+//
+// We avoid a curses library by putting the terminal into cbreak mode
+// with stty(1), so this only works on Unix. Everything else about
+// each interval is processed as usual by reportDeltas; we just keep
+// the results around so that we can redraw them when a key changes
+// how they should look.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+)
+
+var tuiMode bool
+
+// A tuiRow is one device's line, kept so we can redraw it.
+type tuiRow struct {
+	devname string
+	dt      DevDelta
+	ex      lineExtras
+}
+
+// All of our state is shared between processLoop and the goroutine
+// reading keys, so it's protected by tuiMu. reportDeltas holds tuiMu
+// for a whole interval, which also keeps the keys from changing the
+// units out from under it.
+var tuiMu sync.Mutex
+var tuiRows, tuiNext []tuiRow
+
+// tuiCfg is the config of the monitor we're showing, which 'u'
+// changes the units of.
+var tuiCfg *config
+var tuiWhen time.Time
+var tuiSort string
+var tuiFilter string
+var tuiPaused bool
+
+// While we're reading a filter pattern, tuiEditing is set and the
+// pattern so far is in tuiEdit.
+var tuiEditing bool
+var tuiEdit string
+
+// The units 'u' cycles through; "" is adaptive units.
+var tuiByteUnits = []string{"", "KB/s", "MB/s", "GB/s"}
+var tuiBitUnits = []string{"", "Kbit/s", "Mbit/s", "Gbit/s"}
+var tuiDivs = map[string]float64{
+	"KB/s": kB, "MB/s": mB, "GB/s": gB,
+	"Kbit/s": kBit, "Mbit/s": mBit, "Gbit/s": gBit,
+}
+
+// stty runs stty(1) on our terminal with the given arguments and
+// returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	o, err := cmd.Output()
+	return strings.TrimSpace(string(o)), err
+}
+
+// tuiStart puts the terminal into cbreak mode and starts reading
+// keys for the monitor with config c. The terminal is restored when
+// we exit.
+func tuiStart(c *config) error {
+	saved, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("can't get terminal settings (is standard input a terminal?): %s", err)
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return err
+	}
+	atExit(func() { stty(saved) })
+	tuiCfg = c
+	tuiSort = sortBy
+	go tuiReadKeys()
+	return nil
+}
+
+func tuiReadKeys() {
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil || n == 0 {
+			return
+		}
+		if !tuiKey(buf[0]) {
+			runExitFuncs()
+			os.Exit(0)
+		}
+	}
+}
+
+// tuiKey handles a key, redrawing if necessary. It returns false if
+// we should quit.
+func tuiKey(c byte) bool {
+	tuiMu.Lock()
+	defer tuiMu.Unlock()
+
+	if tuiEditing {
+		switch c {
+		case '\n', '\r':
+			tuiFilter = tuiEdit
+			tuiEditing = false
+		case 033:
+			tuiEditing = false
+		case 0177, '\b':
+			if len(tuiEdit) > 0 {
+				tuiEdit = tuiEdit[:len(tuiEdit)-1]
+			}
+		default:
+			if c >= ' ' && c < 0177 {
+				tuiEdit += string(c)
+			}
+		}
+		tuiDraw()
+		return true
+	}
+
+	switch c {
+	case 'q':
+		return false
+	case 'r':
+		tuiSort = "rx"
+	case 't':
+		tuiSort = "tx"
+	case 'a':
+		tuiSort = "total"
+	case 'n':
+		tuiSort = "name"
+	case 'p':
+		tuiPaused = !tuiPaused
+	case 'u':
+		tuiNextUnits()
+	case '/':
+		tuiEditing = true
+		tuiEdit = tuiFilter
+	default:
+		return true
+	}
+	tuiDraw()
+	return true
+}
+
+// tuiNextUnits switches to the next bandwidth units in our cycle.
+func tuiNextUnits() {
+	units := tuiByteUnits
+	if tuiCfg.useBits {
+		units = tuiBitUnits
+	}
+	i := 0
+	for j, u := range units {
+		if u == tuiCfg.bwUnits {
+			i = (j + 1) % len(units)
+			break
+		}
+	}
+	tuiCfg.bwUnits = units[i]
+	tuiCfg.bwDiv = tuiDivs[tuiCfg.bwUnits]
+}
+
+// tuiAdd adds a device's line to the interval being accumulated.
+func tuiAdd(devname string, dt DevDelta, ex lineExtras) {
+	tuiNext = append(tuiNext, tuiRow{devname, dt, ex})
+}
+
+// tuiFinish ends an interval. If we're paused, the display (and what
+// we redraw on keys) stays with the last interval from before then.
+func tuiFinish(when time.Time) {
+	if !tuiPaused {
+		tuiRows, tuiNext = tuiNext, tuiRows
+		tuiWhen = when
+		tuiDraw()
+	}
+	tuiNext = tuiNext[:0]
+}
+
+// tuiDraw redraws the whole screen from tuiRows.
+func tuiDraw() {
+	rows := make([]tuiRow, 0, len(tuiRows))
+	for _, r := range tuiRows {
+		if tuiFilter == "" || glob.Glob(tuiFilter, r.devname) {
+			rows = append(rows, r)
+		}
+	}
+	// Members of a bond or team (-slaves) stay under it, sorted
+	// by name, so we sort them as if they were it.
+	byName := make(map[string]DevDelta, len(tuiRows))
+	for _, r := range tuiRows {
+		byName[r.devname] = r.dt
+	}
+	sortName := func(r tuiRow) string {
+		if r.ex.master != "" {
+			return r.ex.master
+		}
+		return r.devname
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		ni, nj := sortName(rows[i]), sortName(rows[j])
+		if ni != nj {
+			return devLess(tuiSort, ni, nj, byName[ni], byName[nj])
+		}
+		if (rows[i].ex.master == "") != (rows[j].ex.master == "") {
+			return rows[i].ex.master == ""
+		}
+		return rows[i].devname < rows[j].devname
+	})
+
+	screenStart(out, tuiWhen)
+	for _, r := range rows {
+		printDelta(tuiCfg, r.devname, r.dt, r.ex)
+	}
+
+	fmt.Fprintf(out, "\nsort: %s", tuiSort)
+	switch {
+	case tuiEditing:
+		fmt.Fprintf(out, "   filter: %s_", tuiEdit)
+	case tuiFilter != "":
+		fmt.Fprintf(out, "   filter: %s", tuiFilter)
+	}
+	if tuiPaused {
+		fmt.Fprintf(out, "   PAUSED")
+	}
+	fmt.Fprintf(out, "\nkeys: r/t/a/n sort by RX/TX/all/name, u units, p pause, / filter, q quit\n")
+	flushOut()
+}
@@ -0,0 +1,33 @@
+//
+// Showing rates as a percentage of each device's link speed (-util),
+// which means more than raw rates when links differ in capacity.
+// Devices with no known link speed (virtual devices, and everything on
+// systems where we can't find out) don't get percentages.
+//
+
+package main
+
+import (
+	"time"
+
+	"github.com/siebenmann/netvolmon/netvol"
+)
+
+var showUtil bool
+
+// linkSpeed returns a device's link speed in bytes/sec, or 0 if it
+// doesn't have one (or it isn't known).
+func linkSpeed(dev string) float64 {
+	return float64(netvol.LinkSpeed(dev)) / 8
+}
+
+// utilization returns a device's RX and TX rates as percentages of
+// its link speed, and whether it has one.
+func utilization(devname string, dt DevDelta) (float64, float64, bool) {
+	speed := linkSpeed(devname)
+	if speed == 0 {
+		return 0, 0, false
+	}
+	persec := float64(dt.Delta) / float64(time.Second)
+	return float64(dt.RBytes) / persec / speed * 100, float64(dt.TBytes) / persec / speed * 100, true
+}
@@ -0,0 +1,90 @@
+//
+// Version and build information, for -version and, with
+// -version-header, the start of JSON, CSV and line protocol output.
+// That's optional because a leading comment or preamble object can
+// confuse plain CSV and JSON consumers.
+//
+// The version and commit can be set at build time with, eg:
+//	go build -ldflags "-X main.version=1.2 -X main.commit=$(git rev-parse --short HEAD)"
+// Otherwise we use whatever the Go toolchain recorded in the binary,
+// which includes the commit if it was built in a VCS checkout.
+//
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var version string
+var commit string
+
+var versionHeader bool
+
+// buildVersion returns our version and commit, filling in anything
+// not set at link time from the build information if we can. Either
+// may come back as "unknown".
+func buildVersion() (string, string) {
+	v, c := version, commit
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = bi.Main.Version
+		}
+		if c == "" {
+			c = vcsCommit(bi.Settings)
+		}
+	}
+	if v == "" {
+		v = "unknown"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	return v, c
+}
+
+// vcsCommit returns the commit that the toolchain recorded, shortened
+// the way git does and marked if the tree had changes, or "".
+func vcsCommit(settings []debug.BuildSetting) string {
+	var rev string
+	var modified bool
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if rev != "" && modified {
+		rev += "-dirty"
+	}
+	return rev
+}
+
+// versionLine is our version and commit, as one line.
+func versionLine() string {
+	v, c := buildVersion()
+	return fmt.Sprintf("netvolmon %s (commit %s)", v, c)
+}
+
+// printVersion prints our version and build information.
+func printVersion() {
+	fmt.Println(versionLine())
+	fmt.Printf("built with %s for %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, d := range bi.Deps {
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		fmt.Printf("   %s %s\n", d.Path, d.Version)
+	}
+}
@@ -0,0 +1,87 @@
+//
+// VLAN sub-interfaces and their parents (-vlans). With 'rollup', a
+// VLAN device (eth0.100) is reported as its parent (eth0) instead;
+// with 'expand', asking for a parent also gets you all of its VLANs.
+// Which VLANs a device has comes from Linux's /proc/net/vlan/config,
+// and is settled when we start.
+//
+// Rolling up doesn't add the VLANs' traffic to their parent's, since
+// the kernel already counts tagged traffic on the parent device.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+var vlanMode string
+
+// vlanParent maps VLAN devices to their parents.
+var vlanParent map[string]string
+
+// loadVLANs reads /proc/net/vlan/config, which looks like:
+//
+//	VLAN Dev name	 | VLAN ID
+//	Name-Type: VLAN_NAME_TYPE_RAW_PLUS_VID_NO_PAD
+//	eth0.100       | 100  | eth0
+//
+// If it doesn't exist, there are no VLANs (or no 8021q module).
+func loadVLANs() {
+	vlanParent = make(map[string]string)
+	b, err := ioutil.ReadFile("/proc/net/vlan/config")
+	if err != nil {
+		return
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		f := strings.Split(l, "|")
+		if len(f) != 3 {
+			continue
+		}
+		vlanParent[strings.TrimSpace(f[0])] = strings.TrimSpace(f[2])
+	}
+}
+
+// vlanKeys applies -vlans to a list of devices. Devices stay in the
+// order they were given, with a parent's VLANs after it when we're
+// expanding.
+func vlanKeys(keys []string) []string {
+	if vlanMode == "" {
+		return keys
+	}
+	seen := make(set[string])
+	var nkeys []string
+	add := func(k string) {
+		if !seen.isin(k) {
+			seen.add(k)
+			nkeys = append(nkeys, k)
+		}
+	}
+	for _, k := range keys {
+		if p, ok := vlanParent[k]; ok && vlanMode == "rollup" {
+			add(p)
+			continue
+		}
+		add(k)
+		if vlanMode == "expand" {
+			for _, v := range vlanChildren(k) {
+				add(v)
+			}
+		}
+	}
+	return nkeys
+}
+
+// vlanChildren returns a device's VLANs, sorted.
+func vlanChildren(dev string) []string {
+	var kids []string
+	for v, p := range vlanParent {
+		if p == dev {
+			kids = append(kids, v)
+		}
+	}
+	sort.Strings(kids)
+	return kids
+}
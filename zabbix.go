@@ -0,0 +1,83 @@
+//
+// Zabbix support. -format zabbix writes every device's rates each
+// interval as zabbix_sender input with timestamps, for
+// 'zabbix_sender -T -r -i -' (or a file):
+//
+//	- netvolmon.rx_bytes[eth0] 1697450000 1234.5
+//
+// The '-' host means zabbix_sender's own -s or configured host name;
+// -zabbix-host sets one. The keys are netvolmon.rx_bytes, .tx_bytes,
+// .rx_packets and .tx_packets, all per second and all with the device
+// as their parameter, and should be trapper items.
+//
+// -zabbix-discovery just prints the devices we'd monitor as low-level
+// discovery JSON, with {#IFNAME}, {#IFINDEX} and {#IFALIAS} (if
+// there is one), for a discovery rule's item prototypes.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var zabbixHost string
+var zabbixDiscovery bool
+
+// zabbixQuote quotes a zabbix_sender input field if it needs it.
+func zabbixQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// printZabbix writes a device's interval as zabbix_sender lines.
+func printZabbix(devname string, dt DevDelta) {
+	persec := float64(dt.Delta) / float64(time.Second)
+	host := "-"
+	if zabbixHost != "" {
+		host = zabbixQuote(zabbixHost)
+	}
+	put := func(name string, v uint64) {
+		fmt.Fprintf(out, "%s %s %d %s\n", host,
+			zabbixQuote("netvolmon."+name+"["+devname+"]"),
+			dt.When.Unix(), fmtFloat(float64(v)/persec))
+	}
+	put("rx_bytes", dt.RBytes)
+	put("tx_bytes", dt.TBytes)
+	put("rx_packets", dt.RPackets)
+	put("tx_packets", dt.TPackets)
+}
+
+// zabbixFormat is the formatter for zabbix_sender input.
+type zabbixFormat struct{}
+
+func (zabbixFormat) begin(when time.Time) {}
+
+func (zabbixFormat) device(c *config, devname string, dt DevDelta, ex lineExtras) {
+	printZabbix(devname, dt)
+}
+
+func (zabbixFormat) end()           {}
+func (zabbixFormat) header() string { return "" }
+
+// printZabbixDiscovery prints low-level discovery JSON for devices.
+func printZabbixDiscovery(ni *netInfo, devs []string) {
+	lld := make([]map[string]string, 0, len(devs))
+	for _, d := range devs {
+		m := map[string]string{"{#IFNAME}": d}
+		if idx, ok := ni.ifindex[d]; ok {
+			m["{#IFINDEX}"] = fmt.Sprint(idx)
+		}
+		if a := ni.descs[d]; a != "" {
+			m["{#IFALIAS}"] = a
+		}
+		lld = append(lld, m)
+	}
+	json.NewEncoder(os.Stdout).Encode(lld)
+}